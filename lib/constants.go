@@ -6,6 +6,14 @@ import "time"
 const TaskerDir = "/.tasker"
 const EnvFile = "/.env"
 const LastRunsFile = "/last_run.yaml"
+const HistoryFile = "/history.yaml" // in the workspace .tasker dir
+const WsFile = "/workspace.yaml"
+const WsConfFile = "/workspace.conf" // in the workspace .tasker dir, marks the workspace root
+const WsMarkerFile = "/tasker.yaml"  // in the workspace root, alternative way to mark it
+const LegacyWsRootPath = "/workspaces/inference"
+
+// env variables
+const WsRootEnvVar = "TASKER_ROOT"
 
 // bash variables
 const PrependedEnv = "env prepend"
@@ -15,3 +23,4 @@ const FinderRootParam = "finder_root_param"
 
 // utils
 const StdSleepWait = 100 * time.Millisecond
+const StopGracePeriod = 5 * time.Second // between SIGTERM and SIGKILL when stopping tasks
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 
+	ignore "github.com/sabhiram/go-gitignore"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
@@ -46,11 +47,62 @@ func InitProject(filePath string) ProjectDefinition {
 	if err != nil {
 		log.Error("Unmarshal: ", err)
 	}
+	project.resolveTaskIds()
 
 	log.Debug("reading project done!")
 	return project
 }
 
+// resolveTaskIds turns the task ids and deps written relative to the project into full task ids
+// A task id without any "::" is the task name, ex. "build" is "<project>::build".
+// mut: true
+func (project *ProjectDefinition) resolveTaskIds() {
+	for i := range project.TaskDefs {
+		task := &project.TaskDefs[i]
+		if !strings.Contains(string(task.Id), TaskIdSeparator) {
+			task.Id = TaskIdSeparator + task.Id
+		}
+		task.Id = ResolveTaskId(project.Id, task.Id)
+
+		deps := []TaskId{}
+		for _, dep := range task.Deps {
+			deps = append(deps, ResolveTaskId(project.Id, dep))
+		}
+		task.Deps = deps
+	}
+}
+
 func (project ProjectDefinition) GetEnv() string {
 	return "# Prepend project env\n" + "export " + lib.CurrTskrProject + "=\"" + project.Id + "\"\n"
 }
+
+// IgnoreMatcher returns the matcher for the projects own .gitignore file, nil if it has none
+func (project ProjectDefinition) IgnoreMatcher() (*ignore.GitIgnore, error) {
+	ignorePath := project.Path + "/.gitignore"
+	if _, err := os.Stat(ignorePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return ignore.CompileIgnoreFile(ignorePath)
+}
+
+// Fingerprint returns a hash over all files in the project dir (including project.yaml itself)
+// Files ignored by the workspace or project .gitignore and the projects own tasker state are left out.
+func (project ProjectDefinition) Fingerprint(ctxLogger *log.Entry) (string, error) {
+	ignoreMatcher, err := project.IgnoreMatcher()
+	if err != nil {
+		return "", err
+	}
+	files, err := lib.FindFiles(ctxLogger, project.Path, ".*", ignoreMatcher)
+	if err != nil {
+		return "", err
+	}
+
+	// Tasker writes state into .tasker dirs while running tasks, that must not count as a change
+	inputFiles := []string{}
+	for _, file := range files {
+		if !strings.Contains(file+"/", lib.TaskerDir+"/") {
+			inputFiles = append(inputFiles, file)
+		}
+	}
+	return lib.FingerprintFiles(inputFiles)
+}
@@ -1,9 +1,23 @@
 package defs
 
-import "inference-tasker/lib"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"inference-tasker/lib"
+	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// ex. "assets::build", always namespaced by the project id, aka "<project>::<task>"
+// Project ids can contain "::" themselves, ex. "writer::norrland::build" is task "build" of project "writer::norrland"
 type TaskId string
 
+// Separates the project id from the task name in task ids
+const TaskIdSeparator = "::"
+
 type TaskArgs = string
 
 type Condition string
@@ -12,6 +26,8 @@ type Condition string
 // unless-already-run-once
 // unless-explicitly-called
 // unless-fs-changes {arg}
+//
+// A condition can be followed by space separated arguments, ex. "unless-fs-changes src/** go.mod"
 
 const (
 	// Run task only if:
@@ -29,20 +45,153 @@ const (
 	// Run task only if it is called explicitly
 	// Usecases: Like cleaning outputs to start from scratch to shake loose an undefined state
 	ExplicitCondition Condition = "explicit"
+	// Run task only if:
+	// * It's declared inputs changed (the globs in "inputs" and any condition arguments)
+	// * It's declared outputs changed or went missing
+	// * It is called explicitly
+	// Usecases: Tasks in big projects where a change anywhere in the project dir is too coarse
+	FsChangesCondition Condition = "unless-fs-changes"
 )
 
 // mut: false
 type TaskDefinition struct {
-	// ex. "assets::install"
-	Id TaskId `yaml:"id"` // TODO: This currently can conflict with std tasks
+	// ex. "assets::install", can be written as "install" or "::install" in the projects own project.yaml
+	Id TaskId `yaml:"id"`
 	// ex. "once"
 	Cond Condition `yaml:"cond"`
-	// ex. ["assets::build"]
+	// ex. ["assets::build"], deps in the same project can be written as "::build"
 	Deps []TaskId `yaml:"deps"`
 	// ex. "echo 'hello world'" for a bash task
 	Task TaskArgs `yaml:"task"`
+	// What the task is for, shown by `tasker list` and `tasker describe`
+	Description string `yaml:"description,omitempty"`
+	// Globs relative to the project dir, ex. ["src/**/*.go", "go.mod"]
+	// If set only these files count as the tasks inputs instead of the whole project dir
+	Inputs []string `yaml:"inputs,omitempty"`
+	// Globs relative to the project dir, ex. ["out/**"]
+	// Files the task produces, checked to still be as the last successful run left them
+	Outputs []string `yaml:"outputs,omitempty"`
+	// Units taken from the workspace resource pools while running, ex. {mem: 1}
+	Resources map[string]int `yaml:"resources,omitempty"`
+	// Max time the task may run before it is stopped and failed, ex. "10m"
+	// Defaults to the workspace config defaultTimeout, no limit if neither is set
+	Timeout string `yaml:"timeout,omitempty"`
+	// How many times to rerun the task if it fails, for flaky tasks
+	Retries int `yaml:"retries,omitempty"`
+	// Wait before the first retry, doubled for every retry after that, ex. "5s"
+	// Defaults to 1s
+	RetryBackoff string `yaml:"retry_backoff,omitempty"`
+}
+
+// ResolveTaskId resolves a task id relative to the project into a full id, ex. "::build" in project "assets" to "assets::build"
+// Ids that are already full are returned as is.
+func ResolveTaskId(projectId ProjectId, taskId TaskId) TaskId {
+	if strings.HasPrefix(string(taskId), TaskIdSeparator) {
+		return TaskId(projectId) + taskId
+	}
+	return taskId
+}
+
+// TaskName returns the task id without the project, ex. "build" for "assets::build" in project "assets"
+// Returns false if the task id is not namespaced by the project.
+func TaskName(projectId ProjectId, taskId TaskId) (string, bool) {
+	name, ok := strings.CutPrefix(string(taskId), projectId+TaskIdSeparator)
+	if !ok || name == "" || strings.Contains(name, TaskIdSeparator) {
+		return "", false
+	}
+	return name, true
+}
+
+// GetCond returns the tasks condition without arguments, which is the default condition if none is set
+func (task TaskDefinition) GetCond() Condition {
+	fields := strings.Fields(string(task.Cond))
+	if len(fields) == 0 {
+		return DefaultCondition
+	}
+	return Condition(fields[0])
+}
+
+// GetCondArgs returns the arguments given to the tasks condition, if any
+func (task TaskDefinition) GetCondArgs() []string {
+	fields := strings.Fields(string(task.Cond))
+	if len(fields) == 0 {
+		return []string{}
+	}
+	return fields[1:]
+}
+
+// GetInputGlobs returns all the input globs of the task, declared in "inputs" or as "unless-fs-changes" arguments
+func (task TaskDefinition) GetInputGlobs() []string {
+	globs := append([]string{}, task.Inputs...)
+	if task.GetCond() == FsChangesCondition {
+		globs = append(globs, task.GetCondArgs()...)
+	}
+	return globs
+}
+
+// FingerprintInputs returns a hash over the tasks inputs
+// These are the declared input files if there are any, otherwise the whole project dir.
+func (task TaskDefinition) FingerprintInputs(ctxLogger *log.Entry, project ProjectDefinition) (string, error) {
+	globs := task.GetInputGlobs()
+	if len(globs) == 0 {
+		return project.Fingerprint(ctxLogger)
+	}
+	ignoreMatcher, err := project.IgnoreMatcher()
+	if err != nil {
+		return "", err
+	}
+	files, err := lib.FindFiles(ctxLogger, project.Path, lib.GlobsToPattern(project.Path, globs), ignoreMatcher)
+	if err != nil {
+		return "", err
+	}
+	return lib.FingerprintFiles(files)
+}
+
+// FingerprintOutputs returns a hash over the tasks declared outputs, empty if none are declared
+// Outputs are usually gitignored, so ignore files are not applied here.
+func (task TaskDefinition) FingerprintOutputs(ctxLogger *log.Entry, project ProjectDefinition) (string, error) {
+	if len(task.Outputs) == 0 {
+		return "", nil
+	}
+	files, err := lib.FindAllFiles(ctxLogger, project.Path, lib.GlobsToPattern(project.Path, task.Outputs))
+	if err != nil {
+		return "", err
+	}
+	return lib.FingerprintFiles(files)
+}
+
+// GetTimeout returns the max time the task may run, zero if unlimited
+func (task TaskDefinition) GetTimeout(config WorkspaceConfig) (time.Duration, error) {
+	timeout := task.Timeout
+	if timeout == "" {
+		timeout = config.DefaultTimeout
+	}
+	if timeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(timeout)
+}
+
+// GetRetryBackoff returns the wait before the first retry of the task
+func (task TaskDefinition) GetRetryBackoff() (time.Duration, error) {
+	if task.RetryBackoff == "" {
+		return time.Second, nil
+	}
+	return time.ParseDuration(task.RetryBackoff)
 }
 
 func (task TaskDefinition) GetEnv() string {
 	return "# Prepend task env\n" + "export " + lib.CurrTskrTask + "=\"" + string(task.Id) + "\"\n"
 }
+
+// Hash returns a hash of the task definition, used to notice when a task has been redefined
+// The description doesn't change what the task does, so rewording it doesn't count.
+func (task TaskDefinition) Hash() string {
+	task.Description = ""
+	content, err := yaml.Marshal(task)
+	if err != nil {
+		log.Fatal("yaml.Marshal: ", err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,184 @@
+package defs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Validate checks the workspace definitions as a whole, returning all problems found joined together
+// Problems checked:
+// * duplicate project ids and task ids
+// * task ids not namespaced by their project, aka "<project>::<task>"
+// * invalid timeouts and retries
+// * invalid resource pools, and tasks taking from unknown pools or more than a pools capacity
+// * deps that don't exist or are the task itself
+// * dependency cycles, with the path of the cycle
+func (wsd WorkspaceDefinition) Validate() error {
+	problems := []error{}
+
+	if _, err := time.ParseDuration(wsd.Config.DefaultTimeout); wsd.Config.DefaultTimeout != "" && err != nil {
+		problems = append(problems, fmt.Errorf("workspace config: invalid defaultTimeout: %w", err))
+	}
+
+	for _, pool := range sortedKeys(wsd.Config.Pools) {
+		if pool == JobsPool {
+			problems = append(problems, fmt.Errorf("workspace config: pool %s is reserved for the --jobs limit", pool))
+		} else if capacity := wsd.Config.Pools[pool]; capacity <= 0 {
+			problems = append(problems, fmt.Errorf("workspace config: pool %s: invalid capacity: %d", pool, capacity))
+		}
+	}
+
+	projectFiles := map[ProjectId][]string{}
+	taskProjects := map[TaskId][]ProjectId{}
+	for _, project := range wsd.Projects {
+		if project.Id == "" {
+			problems = append(problems, fmt.Errorf("project in %s: has no id", project.File))
+		}
+		projectFiles[project.Id] = append(projectFiles[project.Id], project.File)
+		for _, task := range project.TaskDefs {
+			taskProjects[task.Id] = append(taskProjects[task.Id], project.Id)
+		}
+	}
+	for _, projectId := range sortedKeys(projectFiles) {
+		if files := projectFiles[projectId]; len(files) > 1 {
+			problems = append(problems, fmt.Errorf("project %s: defined more than once, in %s", projectId, strings.Join(files, ", ")))
+		}
+	}
+	for _, taskId := range sortedKeys(taskProjects) {
+		if projectIds := taskProjects[taskId]; len(projectIds) > 1 {
+			problems = append(problems, fmt.Errorf("task %s: defined more than once, in projects %s", taskId, strings.Join(projectIds, ", ")))
+		}
+	}
+
+	for _, project := range wsd.Projects {
+		for _, task := range project.TaskDefs {
+			if _, ok := TaskName(project.Id, task.Id); !ok {
+				problems = append(problems, fmt.Errorf("task %s: id must be %s::<task> in project %s, with no \"::\" in <task>", task.Id, project.Id, project.Id))
+			}
+			if _, err := time.ParseDuration(task.Timeout); task.Timeout != "" && err != nil {
+				problems = append(problems, fmt.Errorf("task %s: invalid timeout: %w", task.Id, err))
+			}
+			if _, err := task.GetRetryBackoff(); err != nil {
+				problems = append(problems, fmt.Errorf("task %s: invalid retry_backoff: %w", task.Id, err))
+			}
+			if task.Retries < 0 {
+				problems = append(problems, fmt.Errorf("task %s: invalid retries: %d", task.Id, task.Retries))
+			}
+			for _, pool := range sortedKeys(task.Resources) {
+				units := task.Resources[pool]
+				capacity, ok := wsd.Config.Pools[pool]
+				if !ok || pool == JobsPool {
+					problems = append(problems, fmt.Errorf("task %s: takes from unknown resource pool %s", task.Id, pool))
+				} else if units <= 0 {
+					problems = append(problems, fmt.Errorf("task %s: invalid units of resource pool %s: %d", task.Id, pool, units))
+				} else if units > capacity {
+					problems = append(problems, fmt.Errorf("task %s: takes %d units of resource pool %s, more than its capacity %d", task.Id, units, pool, capacity))
+				}
+			}
+			for _, dep := range task.Deps {
+				if dep == task.Id {
+					problems = append(problems, fmt.Errorf("task %s: depends on itself", task.Id))
+				} else if !strings.Contains(string(dep), TaskIdSeparator) {
+					problems = append(problems, fmt.Errorf("task %s: dep %s must be <project>::<task>, or ::<task> in the same project", task.Id, dep))
+				} else if _, ok := taskProjects[dep]; !ok {
+					problems = append(problems, fmt.Errorf("task %s: dep %s does not exist", task.Id, dep))
+				}
+			}
+		}
+	}
+
+	for _, cycle := range wsd.findCycles() {
+		path := []string{}
+		for _, taskId := range cycle {
+			path = append(path, string(taskId))
+		}
+		problems = append(problems, fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), path[0]))
+	}
+
+	return errors.Join(problems...)
+}
+
+// findCycles returns every dependency cycle once, as the path of tasks around it
+// Self deps are left out, Validate reports them on their own.
+func (wsd WorkspaceDefinition) findCycles() [][]TaskId {
+	deps := map[TaskId][]TaskId{}
+	taskIds := []TaskId{}
+	for _, project := range wsd.Projects {
+		for _, task := range project.TaskDefs {
+			if _, ok := deps[task.Id]; !ok {
+				taskIds = append(taskIds, task.Id)
+			}
+			deps[task.Id] = append(deps[task.Id], task.Deps...)
+		}
+	}
+
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := map[TaskId]int{}
+	path := []TaskId{}
+	cycles := [][]TaskId{}
+	seen := map[string]bool{}
+
+	var visit func(taskId TaskId)
+	visit = func(taskId TaskId) {
+		state[taskId] = onPath
+		path = append(path, taskId)
+		for _, dep := range deps[taskId] {
+			if dep == taskId {
+				continue
+			}
+			switch state[dep] {
+			case unvisited:
+				if _, ok := deps[dep]; ok {
+					visit(dep)
+				}
+			case onPath:
+				// The cycle is the part of the path from the dep onwards
+				for i := range path {
+					if path[i] == dep {
+						cycle := append([]TaskId{}, path[i:]...)
+						key := cycleKey(cycle)
+						if !seen[key] {
+							seen[key] = true
+							cycles = append(cycles, cycle)
+						}
+						break
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[taskId] = done
+	}
+	for _, taskId := range taskIds {
+		if state[taskId] == unvisited {
+			visit(taskId)
+		}
+	}
+	return cycles
+}
+
+// cycleKey identifies a cycle regardless of which of its tasks it was found from
+func cycleKey(cycle []TaskId) string {
+	ids := []string{}
+	for _, taskId := range cycle {
+		ids = append(ids, string(taskId))
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, "\x00")
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := []K{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,166 @@
+package defs
+
+import (
+	"strings"
+	"testing"
+)
+
+// testWorkspace builds a workspace of one project per entry, each task given as "<task id>: <dep>, <dep>"
+func testWorkspace(projects map[ProjectId][]string) WorkspaceDefinition {
+	wsd := WorkspaceDefinition{}
+	for _, projectId := range sortedKeys(projects) {
+		project := ProjectDefinition{Id: projectId, File: "/ws/" + projectId + "/project.yaml"}
+		for _, task := range projects[projectId] {
+			id, deps, _ := strings.Cut(task, ":")
+			taskDef := TaskDefinition{Id: TaskId(projectId + "::" + strings.TrimSpace(id))}
+			for _, dep := range strings.Split(deps, ",") {
+				if dep = strings.TrimSpace(dep); dep != "" {
+					taskDef.Deps = append(taskDef.Deps, ResolveTaskId(projectId, TaskId(dep)))
+				}
+			}
+			project.TaskDefs = append(project.TaskDefs, taskDef)
+		}
+		wsd.Projects = append(wsd.Projects, project)
+	}
+	return wsd
+}
+
+func TestFindCycles(t *testing.T) {
+	tests := []struct {
+		name     string
+		projects map[ProjectId][]string
+		want     []string
+	}{
+		{
+			name:     "no cycles",
+			projects: map[ProjectId][]string{"a": {"x:", "y: ::x", "z: ::x, ::y"}},
+			want:     []string{},
+		},
+		{
+			name:     "two tasks",
+			projects: map[ProjectId][]string{"a": {"x: ::y", "y: ::x"}},
+			want:     []string{"a::x -> a::y"},
+		},
+		{
+			name:     "across projects",
+			projects: map[ProjectId][]string{"a": {"x: b::y"}, "b": {"y: c::z"}, "c": {"z: a::x"}},
+			want:     []string{"a::x -> b::y -> c::z"},
+		},
+		{
+			name:     "two separate cycles",
+			projects: map[ProjectId][]string{"a": {"x: ::y", "y: ::x", "v: ::w", "w: ::v"}},
+			want:     []string{"a::x -> a::y", "a::v -> a::w"},
+		},
+		{
+			name:     "self deps are left out",
+			projects: map[ProjectId][]string{"a": {"x: ::x"}},
+			want:     []string{},
+		},
+		{
+			name:     "missing deps are left out",
+			projects: map[ProjectId][]string{"a": {"x: ::nope"}},
+			want:     []string{},
+		},
+	}
+	for _, test := range tests {
+		got := []string{}
+		for _, cycle := range testWorkspace(test.projects).findCycles() {
+			path := []string{}
+			for _, taskId := range cycle {
+				path = append(path, string(taskId))
+			}
+			got = append(got, strings.Join(path, " -> "))
+		}
+		if strings.Join(got, "; ") != strings.Join(test.want, "; ") {
+			t.Errorf("%s: got cycles %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		projects map[ProjectId][]string
+		edit     func(wsd *WorkspaceDefinition)
+		// Every problem expected, as a part of its message
+		want []string
+	}{
+		{
+			name:     "valid",
+			projects: map[ProjectId][]string{"a": {"x:", "y: ::x, b::z"}, "b": {"z:"}},
+			want:     []string{},
+		},
+		{
+			name:     "deps",
+			projects: map[ProjectId][]string{"a": {"x: ::x, ::nope, y"}},
+			want:     []string{"a::x: depends on itself", "a::x: dep a::nope does not exist", "a::x: dep y must be <project>::<task>"},
+		},
+		{
+			name:     "cycle",
+			projects: map[ProjectId][]string{"a": {"x: ::y", "y: ::x"}},
+			want:     []string{"dependency cycle: a::x -> a::y -> a::x"},
+		},
+		{
+			name:     "duplicates and namespaces",
+			projects: map[ProjectId][]string{"a": {"x:"}, "b": {"y:"}},
+			edit: func(wsd *WorkspaceDefinition) {
+				wsd.Projects[1].TaskDefs = append(wsd.Projects[1].TaskDefs, wsd.Projects[0].TaskDefs[0])
+				wsd.Projects = append(wsd.Projects, ProjectDefinition{Id: "a", File: "/ws/other/project.yaml"})
+			},
+			want: []string{"project a: defined more than once", "task a::x: defined more than once, in projects a, b", "task a::x: id must be b::<task>"},
+		},
+		{
+			name:     "task settings",
+			projects: map[ProjectId][]string{"a": {"x:"}},
+			edit: func(wsd *WorkspaceDefinition) {
+				wsd.Config.DefaultTimeout = "soon"
+				task := &wsd.Projects[0].TaskDefs[0]
+				task.Timeout = "1 hour"
+				task.RetryBackoff = "-"
+				task.Retries = -1
+			},
+			want: []string{"invalid defaultTimeout", "a::x: invalid timeout", "a::x: invalid retry_backoff", "a::x: invalid retries: -1"},
+		},
+		{
+			name:     "resource pools",
+			projects: map[ProjectId][]string{"a": {"x:", "y:", "z:", "w:"}},
+			edit: func(wsd *WorkspaceDefinition) {
+				wsd.Config.Pools = map[string]int{"mem": 2, "gpu": 0, JobsPool: 4}
+				wsd.Projects[0].TaskDefs[0].Resources = map[string]int{"mem": 2}
+				wsd.Projects[0].TaskDefs[1].Resources = map[string]int{"mem": 3}
+				wsd.Projects[0].TaskDefs[2].Resources = map[string]int{"disk": 1}
+				wsd.Projects[0].TaskDefs[3].Resources = map[string]int{"mem": 0}
+			},
+			want: []string{
+				"pool gpu: invalid capacity: 0",
+				"pool jobs is reserved",
+				"a::y: takes 3 units of resource pool mem, more than its capacity 2",
+				"a::z: takes from unknown resource pool disk",
+				"a::w: invalid units of resource pool mem: 0",
+			},
+		},
+	}
+	for _, test := range tests {
+		wsd := testWorkspace(test.projects)
+		if test.edit != nil {
+			test.edit(&wsd)
+		}
+		problems := []string{}
+		if err := wsd.Validate(); err != nil {
+			problems = strings.Split(err.Error(), "\n")
+		}
+		if len(problems) != len(test.want) {
+			t.Errorf("%s: got %d problems, want %d: %v", test.name, len(problems), len(test.want), problems)
+			continue
+		}
+		for _, want := range test.want {
+			found := false
+			for _, problem := range problems {
+				found = found || strings.Contains(problem, want)
+			}
+			if !found {
+				t.Errorf("%s: no problem with %q in %v", test.name, want, problems)
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package defs
+
+import (
+	"inference-tasker/lib"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Every task takes one unit of this pool, its capacity is the --jobs limit, so it can't be declared in the config
+const JobsPool = "jobs"
+
+// WorkspaceConfig is the user config of the workspace
+// It is read from the root tasker.yaml if it exists, otherwise from .tasker/workspace.conf
+// mut: false
+type WorkspaceConfig struct {
+	// Named resource pools and their capacities, ex. {mem: 2, gpu: 1}
+	// Tasks take units from these with "resources", the runner never hands out more than the capacity
+	Pools map[string]int `yaml:"pools,omitempty"`
+	// Max time any task may run unless it sets its own timeout, ex. "30m"
+	DefaultTimeout string `yaml:"defaultTimeout,omitempty"`
+	// How many run logs to keep per task, defaults to 10
+	LogRetention int `yaml:"logRetention,omitempty"`
+	// How many runs to keep in the workspace history.yaml, by default it is append-only and keeps them all
+	HistoryRetention int `yaml:"historyRetention,omitempty"`
+}
+
+func wsConfPaths() []string {
+	return []string{lib.WsRootPath + lib.WsMarkerFile, lib.WsTaskerPath + lib.WsConfFile}
+}
+
+func readWorkspaceConfig() (WorkspaceConfig, error) {
+	config := WorkspaceConfig{}
+	for _, path := range wsConfPaths() {
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return config, err
+		}
+		err = yaml.Unmarshal(content, &config)
+		return config, err
+	}
+	return config, nil
+}
@@ -3,18 +3,23 @@ package defs
 import (
 	"inference-tasker/lib"
 	"os"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
-// TODO: Set this up in init or something
-const WS_ROOT_PATH = "/workspaces/inference"
-const WS_TASKER_PATH = WS_ROOT_PATH + "/.tasker"
-const WS_FILE_PATH = WS_TASKER_PATH + "/workspace.yaml"
-const WS_ENV_FILE = WS_TASKER_PATH + "/.env"
+// The workspace paths hang off lib.WsRootPath, so lib.InitWsRoot must have been called before these are used
 const WS_PROJECT_FILE = "project.yaml"
 
+func wsFilePath() string {
+	return lib.WsTaskerPath + lib.WsFile
+}
+
+func wsEnvFilePath() string {
+	return lib.WsTaskerPath + lib.EnvFile
+}
+
 // WorkspaceDefinition contains all information about the workspace definitions in the fs
 // It can be dumped to file and reloaded or alternatively inited from scratch
 // mut: false
@@ -23,13 +28,70 @@ type WorkspaceDefinition struct {
 	TaskerPath  string              `yaml:"taskerPath"`
 	DefnPath    string              `yaml:"defnPath"`
 	EnvFilePath string              `yaml:"envFilePath"`
+	Config      WorkspaceConfig     `yaml:"config"`
 	Projects    []ProjectDefinition `yaml:"projects"`
+	Stamps      WorkspaceStamps     `yaml:"stamps"`
+
+	// Positions of the projects and tasks in Projects by id, built on load so lookups don't scan every project
+	projectIndex map[ProjectId]int
+	taskIndex    map[TaskId]taskPosition
+}
+
+type taskPosition struct {
+	project int
+	task    int
+}
+
+// LoadWorkspace loads the workspace from workspace.yaml
+// Only if workspace.yaml is missing or stale (project.yaml files changed, added or removed) is it inited from scratch and dumped.
+// lock: r/w (on workspace.yaml)
+func LoadWorkspace(ctxLogger *log.Entry) WorkspaceDefinition {
+	return loadWorkspace(ctxLogger, false)
+}
+
+// ReinitWorkspace inits the workspace from scratch and dumps it to workspace.yaml, aka `tasker init`
+// lock: r/w (on workspace.yaml)
+func ReinitWorkspace(ctxLogger *log.Entry) WorkspaceDefinition {
+	return loadWorkspace(ctxLogger, true)
+}
+
+func loadWorkspace(ctxLogger *log.Entry, forceInit bool) WorkspaceDefinition {
+	err := initTaskerPath()
+	if err != nil {
+		ctxLogger.Fatal("Error initializing tasker path: ", err)
+	}
+	err = initWorkspaceFile()
+	if err != nil {
+		ctxLogger.Fatal("Error initializing workspace file: ", err)
+	}
+
+	// Tasks call utilbins in parallel, all of which load the workspace, so only one of them should re-init it
+	mm, err := lib.LockFile(wsFilePath())
+	if err != nil {
+		ctxLogger.Fatal("Error locking workspace file: ", err)
+	}
+	defer lib.UnlockFile(mm)
+
+	if !forceInit {
+		ws, err := readWorkspace()
+		if err == nil && ws.RootPath == lib.WsRootPath && ws.Stamps.isFresh(ctxLogger) {
+			ctxLogger.Debug("workspace loaded from: ", ws.DefnPath)
+			ws.buildIndex()
+			return ws
+		}
+		if err != nil {
+			ctxLogger.Debug("workspace file unreadable, re-initing: ", err)
+		}
+	}
+
+	ctxLogger.Debug("initing workspace from scratch")
+	ws := InitWorkspace(ctxLogger)
+	ws.Dump()
+	return ws
 }
 
 // InitWorkspace inits the workspace from scratch - existing workspace.yaml overwritten
-// TODO:
-// Specifically init only with `tasker init` and not on every run.
-// This is faster and safer - as in parallel execution fs might change as looking for project.yaml files.
+// Walks the whole workspace, so prefer LoadWorkspace which only does this when workspace.yaml is stale.
 func InitWorkspace(ctxLogger *log.Entry) WorkspaceDefinition {
 	err := initTaskerPath()
 	if err != nil {
@@ -45,10 +107,15 @@ func InitWorkspace(ctxLogger *log.Entry) WorkspaceDefinition {
 	}
 
 	ws := WorkspaceDefinition{}
-	ws.RootPath = WS_ROOT_PATH
-	ws.TaskerPath = WS_TASKER_PATH
-	ws.DefnPath = WS_FILE_PATH
-	ws.EnvFilePath = WS_ENV_FILE
+	ws.RootPath = lib.WsRootPath
+	ws.TaskerPath = lib.WsTaskerPath
+	ws.DefnPath = wsFilePath()
+	ws.EnvFilePath = wsEnvFilePath()
+
+	ws.Config, err = readWorkspaceConfig()
+	if err != nil {
+		log.Fatal("Error reading workspace config: ", err)
+	}
 
 	// Find all the project.yaml files in the workspace
 	projectDefs, err := findProjectDefs(ctxLogger)
@@ -62,29 +129,24 @@ func InitWorkspace(ctxLogger *log.Entry) WorkspaceDefinition {
 		ws.Projects = append(ws.Projects, InitProject(projectDef))
 	}
 
-	// Validate that all deps actually exist
-	for _, project := range ws.Projects {
-		for _, task := range project.TaskDefs {
-			for _, dep := range task.Deps {
-				if !ws.containsTask(dep) {
-					log.
-						WithFields(log.Fields{
-							"project": project.Id,
-							"task":    task.Id,
-							"dep":     dep,
-						}).
-						Fatal("Invalid dep!")
-				}
-			}
-		}
+	ws.Stamps, err = stampWorkspace(ctxLogger, projectDefs)
+	if err != nil {
+		log.Fatal("Error stamping workspace: ", err)
 	}
 
+	// Report all problems at once rather than having them fixed one run at a time
+	err = ws.Validate()
+	if err != nil {
+		log.Fatal("Invalid workspace:\n\t* ", strings.ReplaceAll(err.Error(), "\n", "\n\t* "))
+	}
+	ws.buildIndex()
+
 	return ws
 }
 
 // Dump dumps the workspace to the workspace.yaml file in the workspace ./tasker dir
 func (ws WorkspaceDefinition) Dump() {
-	wsFile, err := os.OpenFile(WS_FILE_PATH, os.O_WRONLY, 0644)
+	wsFile, err := os.OpenFile(ws.DefnPath, os.O_WRONLY, 0644)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -109,45 +171,79 @@ func (ws WorkspaceDefinition) Dump() {
 // Finders
 //
 
+func readWorkspace() (WorkspaceDefinition, error) {
+	ws := WorkspaceDefinition{}
+	content, err := os.ReadFile(wsFilePath())
+	if err != nil {
+		return ws, err
+	}
+	err = yaml.Unmarshal(content, &ws)
+	return ws, err
+}
+
 //
 // Utils
 //
 
 func initTaskerPath() error {
-	return lib.InitPath(WS_TASKER_PATH)
+	return lib.InitPath(lib.WsTaskerPath)
 }
 
 func initWorkspaceFile() error {
-	return lib.InitFile(WS_FILE_PATH)
+	return lib.InitFile(wsFilePath())
 }
 
 func initEnvFile() error {
-	return lib.InitFile(WS_ENV_FILE)
+	return lib.InitFile(wsEnvFilePath())
 }
 
 func findProjectDefs(ctxLogger *log.Entry) ([]string, error) {
-	return lib.FindFiles(ctxLogger, WS_ROOT_PATH, WS_PROJECT_FILE, nil)
+	return lib.FindFiles(ctxLogger, lib.WsRootPath, WS_PROJECT_FILE, nil)
 }
 
-func (wsd WorkspaceDefinition) containsTask(taskId TaskId) bool {
-	for _, project := range wsd.Projects {
-		for _, task := range project.TaskDefs {
-			if task.Id == taskId {
-				return true
-			}
+// buildIndex indexes the projects and tasks by id, ids are unique once the workspace is validated
+// mut: true
+func (wsd *WorkspaceDefinition) buildIndex() {
+	wsd.projectIndex = map[ProjectId]int{}
+	wsd.taskIndex = map[TaskId]taskPosition{}
+	for i, project := range wsd.Projects {
+		wsd.projectIndex[project.Id] = i
+		for j, task := range project.TaskDefs {
+			wsd.taskIndex[task.Id] = taskPosition{project: i, task: j}
 		}
 	}
-	return false
+}
+
+func (wsd WorkspaceDefinition) HasTask(taskId TaskId) bool {
+	_, ok := wsd.taskIndex[taskId]
+	return ok
+}
+
+func (wsd WorkspaceDefinition) GetTask(taskId TaskId) TaskDefinition {
+	position, ok := wsd.taskIndex[taskId]
+	if !ok {
+		log.Fatal("Task not found: ", taskId)
+	}
+	return wsd.Projects[position.project].TaskDefs[position.task]
+}
+
+func (wsd WorkspaceDefinition) HasProject(projectId ProjectId) bool {
+	_, ok := wsd.projectIndex[projectId]
+	return ok
+}
+
+func (wsd WorkspaceDefinition) GetProject(projectId ProjectId) ProjectDefinition {
+	i, ok := wsd.projectIndex[projectId]
+	if !ok {
+		log.Fatal("Project not found: ", projectId)
+	}
+	return wsd.Projects[i]
 }
 
 func (wsd WorkspaceDefinition) MapTaskToProject(taskId TaskId) ProjectDefinition {
-	for _, project := range wsd.Projects {
-		for _, task := range project.TaskDefs {
-			if task.Id == taskId {
-				return project
-			}
-		}
+	position, ok := wsd.taskIndex[taskId]
+	if !ok {
+		log.Fatal("Project not found for task: ", taskId)
 	}
-	log.Fatal("Project not found for task: ", taskId)
-	return ProjectDefinition{}
+	return wsd.Projects[position.project]
 }
@@ -0,0 +1,86 @@
+package defs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"inference-tasker/lib"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WorkspaceStamps record what the workspace definition was inited from, to tell when workspace.yaml is stale
+// Projects being added or removed is told by the paths of the discovered project.yaml files, rather than by dir mtimes,
+// which tasks writing their outputs change all the time.
+// mut: false
+type WorkspaceStamps struct {
+	// Stamps of the project.yaml files, the workspace .gitignore and config files, aka "/path/to/project.yaml" -> stamp
+	Files map[string]FileStamp `yaml:"files"`
+	// Hash of the paths of all the discovered project.yaml files
+	Projects string `yaml:"projects"`
+}
+
+// A missing file is stamped too, so it being added is noticed
+type FileStamp struct {
+	ModTime int64 `yaml:"mtime"`
+	Size    int64 `yaml:"size"`
+}
+
+var missingFileStamp = FileStamp{ModTime: 0, Size: -1}
+
+func newFileStamp(path string) (FileStamp, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return missingFileStamp, nil
+	}
+	if err != nil {
+		return FileStamp{}, err
+	}
+	return FileStamp{ModTime: info.ModTime().UnixNano(), Size: info.Size()}, nil
+}
+
+func stampWorkspace(ctxLogger *log.Entry, projectFiles []string) (WorkspaceStamps, error) {
+	stamps := WorkspaceStamps{
+		Files: map[string]FileStamp{},
+	}
+
+	files := append([]string{lib.WsRootPath + "/.gitignore"}, wsConfPaths()...)
+	files = append(files, projectFiles...)
+	for _, file := range files {
+		stamp, err := newFileStamp(file)
+		if err != nil {
+			return stamps, err
+		}
+		stamps.Files[file] = stamp
+	}
+	stamps.Projects = hashPaths(projectFiles)
+	return stamps, nil
+}
+
+// hashPaths hashes the list of paths, the order matters but the walk always finds them in the same order
+func hashPaths(paths []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(paths, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// isFresh returns true if nothing stamped has changed, aka the workspace would init to the same definition
+// Walks the workspace to discover the project.yaml files, but reads none of them.
+func (stamps WorkspaceStamps) isFresh(ctxLogger *log.Entry) bool {
+	if len(stamps.Files) == 0 {
+		return false // never stamped
+	}
+	for file, stamp := range stamps.Files {
+		currStamp, err := newFileStamp(file)
+		if err != nil || currStamp != stamp {
+			ctxLogger.Debug("workspace stale, file changed: ", file)
+			return false
+		}
+	}
+	projectFiles, err := findProjectDefs(ctxLogger)
+	if err != nil || hashPaths(projectFiles) != stamps.Projects {
+		ctxLogger.Debug("workspace stale, projects added or removed")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package defs
+
+import (
+	"inference-tasker/lib"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestWorkspaceStampsIsFresh(t *testing.T) {
+	logger := log.NewEntry(log.StandardLogger())
+	tests := []struct {
+		name string
+		// Changes to the workspace after it was stamped
+		change    func(root string) error
+		wantFresh bool
+	}{
+		{name: "unchanged", change: func(root string) error { return nil }, wantFresh: true},
+		{
+			name:      "task outputs written",
+			change:    func(root string) error { return os.WriteFile(root+"/a/out.bin", []byte("built"), 0644) },
+			wantFresh: true,
+		},
+		{
+			name: "project.yaml changed",
+			change: func(root string) error {
+				return os.WriteFile(root+"/a/project.yaml", []byte("id: a\ntasks: []\n"), 0644)
+			},
+			wantFresh: false,
+		},
+		{
+			name: "project added",
+			change: func(root string) error {
+				if err := os.MkdirAll(root+"/b", 0755); err != nil {
+					return err
+				}
+				return os.WriteFile(root+"/b/project.yaml", []byte("id: b\n"), 0644)
+			},
+			wantFresh: false,
+		},
+		{name: "project removed", change: func(root string) error { return os.Remove(root + "/a/project.yaml") }, wantFresh: false},
+	}
+	for _, test := range tests {
+		root := t.TempDir()
+		if err := os.WriteFile(filepath.Join(root, "tasker.yaml"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(root+"/a", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(root+"/a/project.yaml", []byte("id: a\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := lib.InitWsRoot(root); err != nil {
+			t.Fatal(err)
+		}
+
+		projectFiles, err := findProjectDefs(logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stamps, err := stampWorkspace(logger, projectFiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := test.change(root); err != nil {
+			t.Fatal(err)
+		}
+		if got := stamps.isFresh(logger); got != test.wantFresh {
+			t.Errorf("%s: fresh %v, want %v", test.name, got, test.wantFresh)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package lib
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
 	ignore "github.com/sabhiram/go-gitignore"
 	log "github.com/sirupsen/logrus"
 )
@@ -10,19 +15,105 @@ var DefaultLogger = log.WithFields(log.Fields{
 	"extra": "defaultLogger",
 })
 
-// TODO: Read this in from a workspace.conf file in the global context
-var WsRootPath = "/workspaces/inference"
-var WsTaskerPath = WsRootPath + TaskerDir
-var WorkspaceIgnoreMatcher = getWorkspaceIgnoreMatcher()
+// Set by InitWsRoot, which every binary must call before touching the workspace
+var WsRootPath string
+var WsTaskerPath string
+var WorkspaceIgnoreMatcher *ignore.GitIgnore
+
+// InitWsRoot finds the workspace root and sets up the workspace globals
+// The root is the first found of:
+// 1) rootOverride, aka the --root flag
+// 2) the TASKER_ROOT env var (tasker exports it for everything it runs)
+// 3) the closest dir up from the cwd with a .tasker/workspace.conf or tasker.yaml file in it
+// 4) the legacy /workspaces/inference if it exists
+func InitWsRoot(rootOverride string) error {
+	root, err := findWsRoot(rootOverride)
+	if err != nil {
+		return err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("filepath.Abs: %w", err)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return fmt.Errorf("workspace root is not a dir: %s", root)
+	}
+	log.Debug("workspace root: ", root)
+
+	WsRootPath = root
+	WsTaskerPath = WsRootPath + TaskerDir
+	WorkspaceIgnoreMatcher, err = getWorkspaceIgnoreMatcher()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// TakeRootFlag takes a leading "--root <path>" or "--root=<path>" off cli args, for binaries without flag parsing
+func TakeRootFlag(args []string) (string, []string) {
+	if len(args) >= 2 && (args[0] == "--root" || args[0] == "-root") {
+		return args[1], args[2:]
+	}
+	if len(args) >= 1 && (strings.HasPrefix(args[0], "--root=") || strings.HasPrefix(args[0], "-root=")) {
+		return strings.SplitN(args[0], "=", 2)[1], args[1:]
+	}
+	return "", args
+}
+
+func findWsRoot(rootOverride string) (string, error) {
+	if rootOverride != "" {
+		return rootOverride, nil
+	}
+	if envRoot := os.Getenv(WsRootEnvVar); envRoot != "" {
+		return envRoot, nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("os.Getwd: %w", err)
+	}
+	if root, ok := FindMarkedWsRoot(cwd); ok {
+		return root, nil
+	}
+
+	if _, err := os.Stat(LegacyWsRootPath); err == nil {
+		return LegacyWsRootPath, nil
+	}
+	return "", fmt.Errorf(
+		"no workspace root found from %s, mark it with a %s or %s file, or set --root or %s",
+		cwd, TaskerDir+WsConfFile, WsMarkerFile, WsRootEnvVar,
+	)
+}
+
+// FindMarkedWsRoot walks up from fromDir to the closest dir with a .tasker/workspace.conf or tasker.yaml file in it
+func FindMarkedWsRoot(fromDir string) (string, bool) {
+	for dir := fromDir; ; dir = filepath.Dir(dir) {
+		if isFile(dir+TaskerDir+WsConfFile) || isFile(dir+WsMarkerFile) {
+			return dir, true
+		}
+		if dir == filepath.Dir(dir) {
+			return "", false
+		}
+	}
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
 
 // Pick up the top level .gitignore file
 // Each project task handles its own .gitignore file but the global one is always applied
-func getWorkspaceIgnoreMatcher() *ignore.GitIgnore {
-	ignoreMatcher, err := ignore.CompileIgnoreFile(WsRootPath + "/.gitignore")
+func getWorkspaceIgnoreMatcher() (*ignore.GitIgnore, error) {
+	ignorePath := WsRootPath + "/.gitignore"
+	if _, err := os.Stat(ignorePath); os.IsNotExist(err) {
+		return ignore.CompileIgnoreLines(), nil
+	}
+	ignoreMatcher, err := ignore.CompileIgnoreFile(ignorePath)
 	if err != nil {
-		log.Fatalf("ignore.CompileIgnoreFile: %v", err)
+		return nil, fmt.Errorf("ignore.CompileIgnoreFile: %w", err)
 	}
-	return ignoreMatcher
+	return ignoreMatcher, nil
 }
 
 var stdBashEnv = NewScriptHeaderSection(
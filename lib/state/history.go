@@ -0,0 +1,210 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"inference-tasker/lib"
+	"inference-tasker/lib/defs"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RunRecord is what gets persisted about a tasker run in the workspace history.yaml
+type RunRecord struct {
+	// ex. "20230401-120000-abcd"
+	RunId string `yaml:"runId"`
+	// ex. "tasker assets::build -k"
+	Args string `yaml:"args"`
+	// Commit checked out in the workspace at the time, empty if not a git repo
+	GitHead   string             `yaml:"gitHead,omitempty"`
+	StartTime time.Time          `yaml:"startTime"`
+	EndTime   time.Time          `yaml:"endTime"`
+	Tasks     []TaskResultRecord `yaml:"tasks"`
+}
+
+// Result of a task that ran successfully, shared with the runners task results
+const SuccessResult = "success"
+
+// TaskResultRecord is the outcome of one task in a tasker run
+type TaskResultRecord struct {
+	TaskId defs.TaskId `yaml:"taskId"`
+	// ex. "success", see the runners task results
+	Result    string    `yaml:"result"`
+	StartTime time.Time `yaml:"startTime,omitempty"`
+	EndTime   time.Time `yaml:"endTime,omitempty"`
+	// Zero if the task didn't run
+	Attempts int `yaml:"attempts,omitempty"`
+	// Exit status of the last attempt
+	ExitStatus int `yaml:"exitStatus,omitempty"`
+}
+
+// Ran returns true if the task was actually run, not cached or left out
+func (trr TaskResultRecord) Ran() bool {
+	return trr.Attempts > 0 && !trr.StartTime.IsZero() && !trr.EndTime.IsZero()
+}
+
+// Succeeded returns true if the task ran successfully
+func (trr TaskResultRecord) Succeeded() bool {
+	return trr.Result == SuccessResult
+}
+
+func (trr TaskResultRecord) Duration() time.Duration {
+	return trr.EndTime.Sub(trr.StartTime)
+}
+
+// AppendRunHistory appends the run to the workspace history.yaml
+// Runs are only ever appended, unless retention is set, then the oldest runs are pruned so at most retention are kept.
+// Pruning replaces the whole file at once so readers see either version.
+// lock: r/w (on the workspace history.yaml.lock, as pruning replaces history.yaml itself)
+func AppendRunHistory(record RunRecord, retention int) error {
+	path := historyPath()
+	mm, err := lib.LockFile(historyLockPath())
+	if err != nil {
+		return fmt.Errorf("AppendRunHistory: %w", err)
+	}
+	defer lib.UnlockFile(mm)
+
+	content, err := yaml.Marshal(record)
+	if err != nil {
+		return err
+	}
+	historyFile, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer historyFile.Close()
+	// Every run is its own yaml document
+	_, err = historyFile.Write(append([]byte("---\n"), content...))
+	if err != nil {
+		return err
+	}
+	if retention <= 0 {
+		return nil
+	}
+	return pruneRunHistory(historyFile, retention)
+}
+
+// pruneRunHistory rewrites the history file with only its latest retention runs, if it holds more
+// lock: depends on caller write lock
+func pruneRunHistory(historyFile *os.File, retention int) error {
+	info, err := historyFile.Stat()
+	if err != nil {
+		return err
+	}
+	latest, err := readLatestDocuments(historyFile, retention)
+	if err != nil || int64(len(latest)) == info.Size() {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(historyFile.Name()), filepath.Base(historyFile.Name())+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name()) // no-op once renamed
+	_, err = tmpFile.Write(latest)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// CreateTemp makes it 0600
+	err = os.Chmod(tmpFile.Name(), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), historyFile.Name())
+}
+
+// ReadRunHistory returns the latest limit recorded runs (all of them if limit is 0), oldest first
+// Only the end of history.yaml holding those runs is read.
+// lock: none (runs are only ever appended)
+func ReadRunHistory(limit int) ([]RunRecord, error) {
+	records := []RunRecord{}
+	historyFile, err := os.Open(historyPath())
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer historyFile.Close()
+
+	content, err := readLatestDocuments(historyFile, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", historyPath(), err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		record := RunRecord{}
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", historyPath(), err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// How much of the history file is read at a time, going backwards from its end
+const historyChunkSize = 64 * 1024
+
+// readLatestDocuments returns the end of the file holding its latest limit "---" separated yaml documents
+// Every document starts with a "---" line (see AppendRunHistory), which never occurs within one.
+func readLatestDocuments(file *os.File, limit int) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return io.ReadAll(file)
+	}
+
+	separator := []byte("\n---\n")
+	content := []byte{}
+	offset := info.Size()
+	for offset > 0 {
+		chunkSize := int64(historyChunkSize)
+		if chunkSize > offset {
+			chunkSize = offset
+		}
+		offset -= chunkSize
+		chunk := make([]byte, chunkSize)
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		content = append(chunk, content...)
+
+		// More separators than documents asked for means the oldest of them is complete too
+		if bytes.Count(content, separator) > limit {
+			break
+		}
+	}
+
+	// Cut off everything before the start of the oldest document asked for
+	start := len(content)
+	for i := 0; i < limit; i++ {
+		at := bytes.LastIndex(content[:start], separator)
+		if at < 0 {
+			return content, nil // not as many documents as asked for, so the whole file was read
+		}
+		start = at + 1
+	}
+	return content[start:], nil
+}
+
+func historyPath() string {
+	return lib.WsTaskerPath + lib.HistoryFile
+}
+
+func historyLockPath() string {
+	return historyPath() + ".lock"
+}
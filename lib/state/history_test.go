@@ -0,0 +1,130 @@
+package state
+
+import (
+	"fmt"
+	"inference-tasker/lib"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestReadLatestDocuments(t *testing.T) {
+	// Runs big enough that some of them span the chunks the file is read in
+	runIds := []string{"run-1", "run-2", "run-3", "run-4", "run-5"}
+	content := ""
+	for i, runId := range runIds {
+		record := RunRecord{RunId: runId, Args: strings.Repeat("x", i*historyChunkSize/2)}
+		document, err := yaml.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content += "---\n" + string(document)
+	}
+	path := filepath.Join(t.TempDir(), "history.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{limit: 0, want: runIds},
+		{limit: 1, want: []string{"run-5"}},
+		{limit: 2, want: []string{"run-4", "run-5"}},
+		{limit: 5, want: runIds},
+		{limit: 10, want: runIds},
+	}
+	for _, test := range tests {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest, err := readLatestDocuments(file, test.limit)
+		file.Close()
+		if err != nil {
+			t.Fatalf("limit %d: %v", test.limit, err)
+		}
+
+		got := []string{}
+		for _, document := range strings.Split(string(latest), "---\n")[1:] {
+			record := RunRecord{}
+			if err := yaml.Unmarshal([]byte(document), &record); err != nil {
+				t.Fatalf("limit %d: %v", test.limit, err)
+			}
+			got = append(got, record.RunId)
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("limit %d: got runs %v, want %v", test.limit, got, test.want)
+		}
+	}
+}
+
+func TestAppendRunHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		// Runs in history.yaml before the new ones get appended
+		oldRuns   int
+		newRuns   int
+		retention int
+		// How many of the old runs are left after
+		wantOldRuns int
+	}{
+		{name: "append-only by default", oldRuns: 10, newRuns: 10, retention: 0, wantOldRuns: 10},
+		{name: "every append prunes", oldRuns: 50, newRuns: 50, retention: 50, wantOldRuns: 0},
+		{name: "pruned to the retention", oldRuns: 10, newRuns: 5, retention: 8, wantOldRuns: 3},
+		{name: "fewer runs than the retention", oldRuns: 2, newRuns: 2, retention: 5, wantOldRuns: 2},
+	}
+	prevTaskerPath := lib.WsTaskerPath
+	defer func() { lib.WsTaskerPath = prevTaskerPath }()
+	for _, test := range tests {
+		lib.WsTaskerPath = t.TempDir()
+		for i := 0; i < test.oldRuns; i++ {
+			if err := AppendRunHistory(RunRecord{RunId: fmt.Sprint("old-", i)}, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Concurrent runs all get their turn, even while others replace history.yaml by pruning
+		wg := sync.WaitGroup{}
+		for i := 0; i < test.newRuns; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := AppendRunHistory(RunRecord{RunId: fmt.Sprint("new-", i)}, test.retention); err != nil {
+					t.Errorf("%s: %v", test.name, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		records, err := ReadRunHistory(0)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		oldRuns, newRuns := 0, 0
+		for _, record := range records {
+			if strings.HasPrefix(record.RunId, "old-") {
+				oldRuns++
+			} else {
+				newRuns++
+			}
+		}
+		if oldRuns != test.wantOldRuns || newRuns != test.newRuns {
+			t.Errorf("%s: %d old and %d new runs kept, want %d and %d", test.name, oldRuns, newRuns, test.wantOldRuns, test.newRuns)
+		}
+		entries, err := os.ReadDir(lib.WsTaskerPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".tmp") {
+				t.Errorf("%s: tmp file left behind: %s", test.name, entry.Name())
+			}
+		}
+	}
+}
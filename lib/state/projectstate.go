@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"inference-tasker/lib"
 	"inference-tasker/lib/defs"
+	"os"
 	"strings"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // mut: true
@@ -28,9 +31,9 @@ func NewProjectPersistentState(refToDefns RefToDefns) (ProjectPersistentState, e
 
 func (pps *ProjectPersistentState) Load(refToWsDefn RefToDefns) error {
 	states := []TaskPersistentState{}
-	for _, taskDefn := range refToWsDefn.Prj.TaskDefs {
+	for i := range refToWsDefn.Prj.TaskDefs {
 		refToWsDefnCopy := refToWsDefn
-		refToWsDefnCopy.Tsk = &taskDefn
+		refToWsDefnCopy.Tsk = &refToWsDefn.Prj.TaskDefs[i] // not the loop var, it is reused between iterations
 		newState, err := NewTaskPersistentState(refToWsDefnCopy)
 		if err != nil {
 			return err
@@ -43,20 +46,20 @@ func (pps *ProjectPersistentState) Load(refToWsDefn RefToDefns) error {
 }
 
 // Init the project .tasker dir to hold state if it doesn't already exist
+// Called before the state is first written, projects that never had state written keep no .tasker dir.
 func (pps ProjectPersistentState) Init() error {
-	err := lib.InitPath(pps.RefToDefns.Prj.Path + lib.TaskerDir)
-	if err != nil {
-		return err
-	}
-	err = lib.InitFile(pps.EnvPath())
-	if err != nil {
-		return err
-	}
-	err = lib.InitFile(pps.RefToDefns.Prj.Path + lib.TaskerDir + lib.LastRunsFile)
-	if err != nil {
-		return err
+	return initProjectState(*pps.RefToDefns.Prj)
+}
+
+func (pps ProjectPersistentState) GetTaskState(taskId defs.TaskId) TaskPersistentState {
+	for _, taskState := range pps.TaskPersistentStates {
+		if taskState.RefToDefns.Tsk.Id == taskId {
+			return taskState
+		}
 	}
-	return nil
+
+	log.Fatal("Task not found: ", taskId)
+	return TaskPersistentState{}
 }
 
 type SetInProjectEnvParams struct {
@@ -68,6 +71,10 @@ type SetInProjectEnvParams struct {
 // lock: r/w (on the projcets env file)
 func (pps ProjectPersistentState) SetInProjectEnv(params SetInProjectEnvParams) error {
 	envPath := pps.EnvPath()
+	err := pps.Init()
+	if err != nil {
+		return fmt.Errorf("SetInProjectEnv: %w", err)
+	}
 
 	// Any parallel process could potentianlly try to access the same env file.
 	// So we need to lock it with exclusive access until we are done with this invocation of setter.
@@ -101,11 +108,14 @@ func (pps ProjectPersistentState) SetInProjectEnv(params SetInProjectEnvParams)
 // GetProjectEnv returns the project env file content + static export of the current project id
 // lock: r (on the projcts env file)
 func (pps ProjectPersistentState) GetProjectEnv() (string, error) {
-	mm, err := lib.LockFile(pps.EnvPath())
-	if err != nil {
-		return "", fmt.Errorf("GetProjectEnv: %w", err)
+	// Locking creates the env file, a project without one has nothing to lock (see ReadScriptHeader)
+	if _, err := os.Stat(pps.EnvPath()); err == nil {
+		mm, err := lib.LockFile(pps.EnvPath())
+		if err != nil {
+			return "", fmt.Errorf("GetProjectEnv: %w", err)
+		}
+		defer lib.UnlockFile(mm)
 	}
-	defer lib.UnlockFile(mm)
 	content, err := lib.ReadScriptHeader(pps.EnvPath())
 	if err != nil {
 		return "", err
@@ -120,3 +130,16 @@ func (pps ProjectPersistentState) GetProjectEnv() (string, error) {
 func (pps ProjectPersistentState) EnvPath() string {
 	return pps.RefToDefns.Prj.Path + lib.TaskerDir + lib.EnvFile
 }
+
+// initProjectState creates the project .tasker dir and its state files if they don't already exist
+func initProjectState(prj defs.ProjectDefinition) error {
+	err := lib.InitPath(prj.Path + lib.TaskerDir)
+	if err != nil {
+		return err
+	}
+	err = lib.InitFile(prj.Path + lib.TaskerDir + lib.EnvFile)
+	if err != nil {
+		return err
+	}
+	return lib.InitFile(lastRunsPath(prj))
+}
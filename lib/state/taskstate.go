@@ -1,22 +1,138 @@
 package state
 
-// mut: false
+import (
+	"fmt"
+	"inference-tasker/lib"
+	"inference-tasker/lib/defs"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TaskRunRecord is what gets persisted about the runs of a task in the projects last_run.yaml
+type TaskRunRecord struct {
+	// When the task last finished running, whether successfully or not
+	LastRun time.Time `yaml:"lastRun"`
+	// Exit status of the last run
+	ExitStatus int `yaml:"exitStatus"`
+	// When the task last finished running successfully, zero if never
+	LastSuccess time.Time `yaml:"lastSuccess"`
+	// Hash of the task definition the last successful run was done with
+	DefnHash string `yaml:"defnHash"`
+	// Fingerprint of the task inputs the last successful run was done with, empty if not tracked
+	InputsHash string `yaml:"inputsHash"`
+	// Fingerprint of the task outputs the last successful run left behind, empty if not tracked
+	OutputsHash string `yaml:"outputsHash"`
+}
+
+// mut: true
 type TaskPersistentState struct {
-	RefToDefns RefToDefns // mut: false
+	RefToDefns RefToDefns    // mut: false
+	LastRun    TaskRunRecord // mut: true
 }
 
 func NewTaskPersistentState(refToDefns RefToDefns) (TaskPersistentState, error) {
 	newState := TaskPersistentState{}
-	newState.Load(refToDefns)
+	err := newState.Load(refToDefns)
+	if err != nil {
+		return newState, err
+	}
 	return newState, nil
 }
 
-func (tps TaskPersistentState) Load(refToWsDefn RefToDefns) (TaskPersistentState, error) {
-	return TaskPersistentState{
-		refToWsDefn,
-	}, nil
+// Load reads the tasks run record from the projects last_run.yaml
+// lock: none (a stale read is fine, the record is only written after the task has run)
+func (tps *TaskPersistentState) Load(refToWsDefn RefToDefns) error {
+	if refToWsDefn.Prj == nil || refToWsDefn.Tsk == nil {
+		return fmt.Errorf("TaskPersistentState.Load: refToDefns.Prj or refToDefns.Tsk is nil")
+	}
+	records, err := readTaskRunRecords(lastRunsPath(*refToWsDefn.Prj))
+	if err != nil {
+		return fmt.Errorf("readTaskRunRecords: %w", err)
+	}
+	tps.RefToDefns = refToWsDefn
+	tps.LastRun = records[refToWsDefn.Tsk.Id]
+	return nil
 }
 
+// Dump writes the tasks run record to the projects last_run.yaml, records of other tasks are kept as is
+// lock: r/w (on the projects last_run.yaml)
 func (tps TaskPersistentState) Dump() error {
-	return nil
+	path := lastRunsPath(*tps.RefToDefns.Prj)
+	err := initProjectState(*tps.RefToDefns.Prj)
+	if err != nil {
+		return fmt.Errorf("TaskPersistentState.Dump: %w", err)
+	}
+
+	// Tasks of the same project can finish in parallel so the read-modify-write must be exclusive
+	mm, err := lib.LockFile(path)
+	if err != nil {
+		return fmt.Errorf("TaskPersistentState.Dump: %w", err)
+	}
+	defer lib.UnlockFile(mm)
+
+	records, err := readTaskRunRecords(path)
+	if err != nil {
+		return fmt.Errorf("readTaskRunRecords: %w", err)
+	}
+	records[tps.RefToDefns.Tsk.Id] = tps.LastRun
+
+	content, err := yaml.Marshal(records)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// RecordRun updates the run record with the outcome of a run that just finished
+func (tps *TaskPersistentState) RecordRun(endTime time.Time, exitStatus int, inputsHash string, outputsHash string) {
+	tps.LastRun.LastRun = endTime
+	tps.LastRun.ExitStatus = exitStatus
+	if exitStatus == 0 {
+		tps.LastRun.LastSuccess = endTime
+		tps.LastRun.DefnHash = tps.RefToDefns.Tsk.Hash()
+		tps.LastRun.InputsHash = inputsHash
+		tps.LastRun.OutputsHash = outputsHash
+	}
+}
+
+// HasSucceeded returns true if the task has run successfully before with its current definition
+func (tps TaskPersistentState) HasSucceeded() bool {
+	return !tps.LastRun.LastSuccess.IsZero() && tps.LastRun.DefnHash == tps.RefToDefns.Tsk.Hash()
+}
+
+// HasInputsChanged returns true if the inputs fingerprint differs from the one of the last successful run
+func (tps TaskPersistentState) HasInputsChanged(inputsHash string) bool {
+	return tps.LastRun.InputsHash != inputsHash
+}
+
+// HasOutputsChanged returns true if the outputs fingerprint differs from the one of the last successful run
+func (tps TaskPersistentState) HasOutputsChanged(outputsHash string) bool {
+	return tps.LastRun.OutputsHash != outputsHash
+}
+
+//
+// Utils
+//
+
+func lastRunsPath(prj defs.ProjectDefinition) string {
+	return prj.Path + lib.TaskerDir + lib.LastRunsFile
+}
+
+// lock: depends on caller read lock
+func readTaskRunRecords(path string) (map[defs.TaskId]TaskRunRecord, error) {
+	records := map[defs.TaskId]TaskRunRecord{}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(content, &records)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
 }
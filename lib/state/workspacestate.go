@@ -23,9 +23,9 @@ func NewWorkspacePersistentState(refToDefns RefToDefns) (WorkspacePersistentStat
 
 func (s *WorkspacePersistentState) Load(refToWsDefn RefToDefns) error {
 	states := []ProjectPersistentState{}
-	for _, prjDefn := range refToWsDefn.Wsp.Projects {
+	for i := range refToWsDefn.Wsp.Projects {
 		refToWsDefnCopy := refToWsDefn
-		refToWsDefnCopy.Prj = &prjDefn
+		refToWsDefnCopy.Prj = &refToWsDefn.Wsp.Projects[i] // not the loop var, it is reused between iterations
 		newState, err := NewProjectPersistentState(refToWsDefnCopy)
 		if err != nil {
 			return err
@@ -43,7 +43,7 @@ func (s WorkspacePersistentState) Dump() error {
 
 // TODO: Implement in fs when needed
 func (s WorkspacePersistentState) ReadScriptHeader() string {
-	workspaceHeader := "export ws_root_path=" + lib.WsRootPath + "\n"
+	workspaceHeader := "export ws_root_path=" + lib.ShellQuote(lib.WsRootPath) + "\n"
 	return lib.NewScriptHeaderSection(
 		"workspace",
 		workspaceHeader,
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker/common"
+	"inference-tasker/lib/tasker/tasks"
+	"strings"
+)
+
+// List prints the projects and their tasks, aka `tasker list [project]`
+func List(ctx common.Context, targs common.TaskerArgs) {
+	projectId := defs.ProjectId(targs.Target)
+	if projectId != "" && !ctx.HasProjectDef(projectId) {
+		ctx.Logger.Fatal("no project found: ", projectId)
+	}
+
+	for _, project := range ctx.Workspace.Definition.Projects {
+		if projectId != "" && project.Id != projectId {
+			continue
+		}
+		fmt.Printf("%s  (%s)\n", project.Id, project.Path)
+		for _, task := range project.TaskDefs {
+			fmt.Printf("  %s  [%s]\n", task.Id, task.GetCond())
+			if task.Description != "" {
+				fmt.Println("      " + task.Description)
+			}
+			if len(task.Deps) != 0 {
+				fmt.Println("      deps: " + joinTaskIds(task.Deps))
+			}
+		}
+	}
+}
+
+// Describe prints everything about a task, aka `tasker describe <task>`
+// The script is shown with the env header composed exactly as RunBash prepends it.
+func Describe(ctx common.Context, targs common.TaskerArgs) {
+	taskId := defs.TaskId(targs.Target)
+	if taskId == "" {
+		ctx.Logger.Fatal("usage: tasker describe <task>")
+	}
+	if !ctx.HasTaskDef(taskId) {
+		ctx.Logger.Fatal("no task found: ", taskId)
+	}
+	task := ctx.GetTaskDef(taskId)
+	project := ctx.MapTaskToProject(taskId)
+
+	dependents := []defs.TaskId{}
+	for _, otherTask := range ctx.GetAllTaskDefs() {
+		for _, dep := range otherTask.Deps {
+			if dep == taskId {
+				dependents = append(dependents, otherTask.Id)
+				break
+			}
+		}
+	}
+
+	envHeader, err := tasks.EnvHeader(ctx, project, task)
+	if err != nil {
+		ctx.Logger.Fatal("Error composing env header: ", err)
+	}
+
+	fmt.Println("task:         ", task.Id)
+	fmt.Println("project:      ", project.Id, "("+project.File+")")
+	if task.Description != "" {
+		fmt.Println("description:  ", task.Description)
+	}
+	fmt.Println("cond:         ", strings.TrimSpace(string(task.GetCond())+" "+strings.Join(task.GetCondArgs(), " ")))
+	fmt.Println("deps:         ", joinTaskIds(task.Deps))
+	fmt.Println("dependents:   ", joinTaskIds(dependents))
+	if len(task.Inputs) != 0 {
+		fmt.Println("inputs:       ", strings.Join(task.Inputs, ", "))
+	}
+	if len(task.Outputs) != 0 {
+		fmt.Println("outputs:      ", strings.Join(task.Outputs, ", "))
+	}
+	if task.Timeout != "" {
+		fmt.Println("timeout:      ", task.Timeout)
+	}
+	if task.Retries != 0 {
+		fmt.Println("retries:      ", task.Retries)
+	}
+	fmt.Println("last run:     ", lastRunStatus(ctx, taskId))
+	fmt.Println()
+	fmt.Println("# script:")
+	fmt.Println(strings.TrimRight(task.Task, "\n"))
+	fmt.Println()
+	fmt.Println("# env header, prepended to the script when run:")
+	fmt.Print(envHeader)
+}
+
+func joinTaskIds(taskIds []defs.TaskId) string {
+	if len(taskIds) == 0 {
+		return "-"
+	}
+	ids := []string{}
+	for _, taskId := range taskIds {
+		ids = append(ids, string(taskId))
+	}
+	return strings.Join(ids, ", ")
+}
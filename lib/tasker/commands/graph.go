@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker/common"
+	"inference-tasker/lib/tasker/scheduler"
+	"strings"
+)
+
+// Formats the task graph can be written in
+const (
+	DotGraphFormat     = "dot"
+	MermaidGraphFormat = "mermaid"
+	JsonGraphFormat    = "json"
+)
+
+// A project and the tasks of it in the graph, in workspace order
+type graphProject struct {
+	Id    defs.ProjectId `json:"id"`
+	Tasks []graphTask    `json:"tasks"`
+}
+
+type graphTask struct {
+	Id   defs.TaskId   `json:"id"`
+	Deps []defs.TaskId `json:"deps"`
+	// Only set with --annotate
+	Cond    string `json:"cond,omitempty"`
+	LastRun string `json:"lastRun,omitempty"`
+}
+
+// Graph prints the task dependency graph, aka `tasker graph [target] [--format dot|mermaid|json] [--annotate]`
+// With a target only the tasks a run of it involves are included, explicit tasks left out of the run too.
+// Edges point from a dep to the task depending on it, aka the order tasks run in.
+func Graph(ctx common.Context, targs common.TaskerArgs) {
+	projects := graphProjects(ctx, targs)
+
+	switch targs.Format {
+	case DotGraphFormat:
+		fmt.Print(buildDotGraph(projects))
+	case MermaidGraphFormat:
+		fmt.Print(buildMermaidGraph(projects))
+	case JsonGraphFormat:
+		content, err := json.MarshalIndent(projects, "", "  ")
+		if err != nil {
+			ctx.Logger.Fatal("Error building graph: ", err)
+		}
+		fmt.Println(string(content))
+	default:
+		ctx.Logger.Fatal("--format must be one of dot, mermaid or json, got: ", targs.Format)
+	}
+}
+
+// graphProjects returns the tasks in the graph grouped by project
+func graphProjects(ctx common.Context, targs common.TaskerArgs) []graphProject {
+	included := map[defs.TaskId]bool{}
+	if targs.Target == "" {
+		for _, task := range ctx.GetAllTaskDefs() {
+			included[task.Id] = true
+		}
+	} else {
+		targs.ResolveTarget(ctx)
+		selectedTasks, excludedTaskIds := scheduler.SelectTaskDefs(ctx, targs)
+		for _, task := range selectedTasks {
+			included[task.Id] = true
+		}
+		for _, taskId := range excludedTaskIds {
+			included[taskId] = true
+		}
+	}
+
+	projects := []graphProject{}
+	for _, project := range ctx.Workspace.Definition.Projects {
+		tasks := []graphTask{}
+		for _, task := range project.TaskDefs {
+			if !included[task.Id] {
+				continue
+			}
+			// Deps the graph doesn't include would be edges to nowhere
+			deps := []defs.TaskId{}
+			for _, dep := range task.Deps {
+				if included[dep] {
+					deps = append(deps, dep)
+				}
+			}
+			graphTask := graphTask{Id: task.Id, Deps: deps}
+			if targs.Annotate {
+				graphTask.Cond = string(task.GetCond())
+				graphTask.LastRun = lastRunStatus(ctx, task.Id)
+			}
+			tasks = append(tasks, graphTask)
+		}
+		if len(tasks) != 0 {
+			projects = append(projects, graphProject{Id: project.Id, Tasks: tasks})
+		}
+	}
+	return projects
+}
+
+func buildDotGraph(projects []graphProject) string {
+	graph := "digraph tasker {\n\trankdir=LR;\n\tnode [shape=box];\n"
+	for i, project := range projects {
+		graph += fmt.Sprintf("\tsubgraph cluster_%d {\n\t\tlabel=%s;\n", i, dotQuote(project.Id))
+		for _, task := range project.Tasks {
+			graph += fmt.Sprintf("\t\t%s [label=%s];\n", dotQuote(string(task.Id)), dotQuote(strings.Join(taskLabel(task), "\n")))
+		}
+		graph += "\t}\n"
+	}
+	for _, project := range projects {
+		for _, task := range project.Tasks {
+			for _, dep := range task.Deps {
+				graph += fmt.Sprintf("\t%s -> %s;\n", dotQuote(string(dep)), dotQuote(string(task.Id)))
+			}
+		}
+	}
+	return graph + "}\n"
+}
+
+func buildMermaidGraph(projects []graphProject) string {
+	// Task ids aren't valid mermaid node ids, so nodes get numbered ones
+	nodeIds := map[defs.TaskId]string{}
+	for _, project := range projects {
+		for _, task := range project.Tasks {
+			nodeIds[task.Id] = fmt.Sprintf("t%d", len(nodeIds))
+		}
+	}
+
+	graph := "flowchart LR\n"
+	for i, project := range projects {
+		graph += fmt.Sprintf("\tsubgraph p%d [%s]\n", i, mermaidQuote(project.Id))
+		for _, task := range project.Tasks {
+			graph += fmt.Sprintf("\t\t%s[%s]\n", nodeIds[task.Id], mermaidQuote(strings.Join(taskLabel(task), "<br/>")))
+		}
+		graph += "\tend\n"
+	}
+	for _, project := range projects {
+		for _, task := range project.Tasks {
+			for _, dep := range task.Deps {
+				graph += fmt.Sprintf("\t%s --> %s\n", nodeIds[dep], nodeIds[task.Id])
+			}
+		}
+	}
+	return graph
+}
+
+// taskLabel returns the lines to show for a task node, the id and annotations if any
+func taskLabel(task graphTask) []string {
+	label := []string{string(task.Id)}
+	if task.Cond != "" {
+		label = append(label, "cond: "+task.Cond)
+	}
+	if task.LastRun != "" {
+		label = append(label, "last run: "+task.LastRun)
+	}
+	return label
+}
+
+// lastRunStatus describes the last run of the task from its persisted state, ex. "failed (exit 1) at ..."
+func lastRunStatus(ctx common.Context, taskId defs.TaskId) string {
+	lastRun := ctx.GetTaskState(taskId).LastRun
+	if lastRun.LastRun.IsZero() {
+		return "never"
+	}
+	at := lastRun.LastRun.Local().Format("2006-01-02 15:04:05")
+	if lastRun.ExitStatus != 0 {
+		return fmt.Sprintf("failed (exit %d) at %s", lastRun.ExitStatus, at)
+	}
+	return "succeeded at " + at
+}
+
+func dotQuote(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(s) + "\""
+}
+
+func mermaidQuote(s string) string {
+	return "\"" + strings.ReplaceAll(s, "\"", "#quot;") + "\""
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"fmt"
+	"inference-tasker/lib/state"
+	"inference-tasker/lib/tasker/common"
+	"sort"
+	"strings"
+)
+
+// History lists past runs from the workspace run history, latest first, aka `tasker history [--limit N]`
+func History(ctx common.Context, targs common.TaskerArgs) {
+	runs := readHistory(ctx, targs.Limit)
+	if len(runs) == 0 {
+		fmt.Println("no runs recorded yet")
+		return
+	}
+
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		gitHead := run.GitHead
+		if len(gitHead) > 8 {
+			gitHead = gitHead[:8]
+		}
+		if gitHead == "" {
+			gitHead = "-"
+		}
+		fmt.Printf("%s  %s  %8dms  %-8s  %s\n    %s\n",
+			run.RunId,
+			run.StartTime.Local().Format("2006-01-02 15:04:05"),
+			run.EndTime.Sub(run.StartTime).Milliseconds(),
+			gitHead,
+			run.Args,
+			countResults(run),
+		)
+	}
+}
+
+// readHistory returns the latest limit runs of the run history, oldest first, all of them if limit is 0
+func readHistory(ctx common.Context, limit int) []state.RunRecord {
+	runs, err := state.ReadRunHistory(limit)
+	if err != nil {
+		ctx.Logger.Fatal("Error reading run history: ", err)
+	}
+	return runs
+}
+
+// countResults summarizes the task results of a run, ex. "success: 3, cached: 2"
+func countResults(run state.RunRecord) string {
+	counts := map[string]int{}
+	for _, task := range run.Tasks {
+		counts[task.Result]++
+	}
+	results := []string{}
+	for result := range counts {
+		results = append(results, result)
+	}
+	sort.Strings(results)
+
+	summary := []string{}
+	for _, result := range results {
+		summary = append(summary, fmt.Sprintf("%s: %d", result, counts[result]))
+	}
+	if len(summary) == 0 {
+		return "no tasks"
+	}
+	return strings.Join(summary, ", ")
+}
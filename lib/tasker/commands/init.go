@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"fmt"
+	"inference-tasker/lib"
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker/common"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const wsConfTemplate = "# tasker workspace config, this file marks the workspace root\n"
+
+// Init marks the workspace root and inits workspace.yaml from scratch, aka `tasker init`
+// The root is the --root flag or $TASKER_ROOT if set, otherwise the closest already marked root or the cwd.
+func Init(ctxLogger *log.Entry, targs common.TaskerArgs) {
+	root := targs.Root
+	if root == "" && os.Getenv(lib.WsRootEnvVar) == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			ctxLogger.Fatal("os.Getwd: ", err)
+		}
+		root = cwd
+		if markedRoot, ok := lib.FindMarkedWsRoot(cwd); ok {
+			root = markedRoot
+		}
+	}
+	err := lib.InitWsRoot(root)
+	if err != nil {
+		ctxLogger.Fatal("Error finding workspace root: ", err)
+	}
+
+	err = lib.InitPath(lib.WsTaskerPath)
+	if err != nil {
+		ctxLogger.Fatal("Error initializing tasker path: ", err)
+	}
+	confPath := lib.WsTaskerPath + lib.WsConfFile
+	if _, err := os.Stat(confPath); os.IsNotExist(err) {
+		err = os.WriteFile(confPath, []byte(wsConfTemplate), 0644)
+		if err != nil {
+			ctxLogger.Fatal("Error writing workspace conf: ", err)
+		}
+	}
+
+	ws := defs.ReinitWorkspace(ctxLogger)
+	taskCount := 0
+	for _, project := range ws.Projects {
+		taskCount += len(project.TaskDefs)
+	}
+	fmt.Printf("inited workspace %s: %d projects, %d tasks\n", ws.RootPath, len(ws.Projects), taskCount)
+}
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"fmt"
+	"inference-tasker/lib"
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker/common"
+	"inference-tasker/lib/tasker/tasks"
+	"io"
+	"os"
+	"time"
+)
+
+// Logs prints the log of a task run, aka `tasker logs <task> [--run <id>] [--follow] [--list]`
+// Without --run the log of the latest run is printed, --follow keeps printing what gets appended to it.
+func Logs(ctx common.Context, targs common.TaskerArgs) {
+	taskId := defs.TaskId(targs.Target)
+	if taskId == "" {
+		ctx.Logger.Fatal("usage: tasker logs <task> [--run <id>] [--follow] [--list]")
+	}
+	if !ctx.HasTaskDef(taskId) {
+		ctx.Logger.Fatal("no task found: ", taskId)
+	}
+	project := ctx.MapTaskToProject(taskId)
+
+	runIds, err := tasks.ListLogRunIds(project, taskId)
+	if err != nil {
+		ctx.Logger.Fatal("Error listing logs: ", err)
+	}
+	if targs.List {
+		for _, runId := range runIds {
+			fmt.Println(runId)
+		}
+		return
+	}
+
+	runId, found := pickRunId(runIds, targs.Run)
+	if !found && targs.Follow {
+		// The task may be queued but not started yet, its log shows up once it does
+		ctx.Logger.Info("waiting for a log of task: ", taskId)
+	}
+	for !found && targs.Follow {
+		time.Sleep(lib.StdSleepWait)
+		runIds, err = tasks.ListLogRunIds(project, taskId)
+		if err != nil {
+			ctx.Logger.Fatal("Error listing logs: ", err)
+		}
+		runId, found = pickRunId(runIds, targs.Run)
+	}
+	if !found && targs.Run == "" {
+		ctx.Logger.Fatal("no logs kept for task: ", taskId)
+	}
+	if !found {
+		ctx.Logger.Fatal("no log kept for run ", runId, " of task: ", taskId)
+	}
+
+	logFile, err := os.Open(tasks.LogPath(project, taskId, runId))
+	if err != nil {
+		ctx.Logger.Fatal("Error opening log: ", err)
+	}
+	defer logFile.Close()
+
+	_, err = io.Copy(os.Stdout, logFile)
+	if err != nil {
+		ctx.Logger.Fatal("Error reading log: ", err)
+	}
+
+	// Like tail -f, runs until interrupted
+	for targs.Follow {
+		n, err := io.Copy(os.Stdout, logFile)
+		if err != nil {
+			ctx.Logger.Fatal("Error reading log: ", err)
+		}
+		if n == 0 {
+			time.Sleep(lib.StdSleepWait)
+		}
+	}
+}
+
+// pickRunId returns the given run id if it has a log, without one the latest run id, false if there is no such log
+func pickRunId(runIds []string, runId string) (string, bool) {
+	if runId == "" {
+		if len(runIds) == 0 {
+			return "", false
+		}
+		return runIds[len(runIds)-1], true
+	}
+	return runId, containsRunId(runIds, runId)
+}
+
+func containsRunId(runIds []string, runId string) bool {
+	for _, id := range runIds {
+		if id == runId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"fmt"
+	"inference-tasker/lib/tasker/common"
+	"inference-tasker/lib/tasker/scheduler"
+	"inference-tasker/lib/tasker/skipper"
+	"inference-tasker/lib/tasker/tasks"
+
+	"github.com/fatih/color"
+)
+
+// DryRun prints what a run of the target would do without running anything, aka `tasker --dry-run <target>`
+// Tasks go through the scheduler and skipper as in a real run, assuming every task that would run succeeds.
+// Each wave is the tasks whose deps are all done once the waves before it are, so they could run in parallel.
+// The --jobs limit and resource pools are left out, a real run may start the tasks of a wave a few at a time.
+func DryRun(ctx common.Context, targs common.TaskerArgs) {
+	sched := scheduler.NewScheduler(&ctx, targs)
+	skip := skipper.NewSkipper(&ctx, targs)
+
+	toRun, toSkip := 0, 0
+	for wave := 1; !sched.AllComplete(); wave++ {
+		waveTaskDefs := sched.GetAllSchedulable()
+		if len(waveTaskDefs) == 0 {
+			ctx.Logger.Fatal("no tasks can be scheduled, but some are left, the graph is invalid")
+		}
+
+		fmt.Printf("wave %d:\n", wave)
+		for _, taskDef := range waveTaskDefs {
+			sched.MarkScheduled(taskDef)
+		}
+		// Decided only once the whole wave is scheduled, so deps are marked the same as in a real run
+		for _, taskDef := range waveTaskDefs {
+			task := tasks.NewTask(ctx, taskDef, "", targs.Output)
+			shouldSkip, reason := skip.Decide(&task, sched.AnyDepRan(taskDef))
+			if shouldSkip {
+				toSkip++
+				sched.MarkCached(taskDef)
+				fmt.Printf("  %s %s  (%s)\n", color.BlueString("%s", "\u267A"), taskDef.Id, reason)
+			} else {
+				toRun++
+				sched.MarkCompleted(taskDef)
+				fmt.Printf("  %s %s  (%s)\n", color.GreenString("%s", "\u23F5"), taskDef.Id, reason)
+			}
+		}
+	}
+
+	_, excludedTaskIds := scheduler.SelectTaskDefs(ctx, targs)
+	if len(excludedTaskIds) != 0 {
+		fmt.Println("left out:")
+		for _, taskId := range excludedTaskIds {
+			fmt.Printf("  %s %s  (explicit-only)\n", color.YellowString("%s", "\u2298"), taskId)
+		}
+	}
+	fmt.Printf("%d to run, %d to skip, %d left out\n", toRun, toSkip, len(excludedTaskIds))
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker"
+	"inference-tasker/lib/tasker/common"
+	"math"
+	"sort"
+	"time"
+)
+
+// Stats shows how a task did over past runs, aka `tasker stats <task> [--limit N]`
+// Durations and the failure rate only count runs where the task actually ran.
+func Stats(ctx common.Context, targs common.TaskerArgs) {
+	taskId := defs.TaskId(targs.Target)
+	if taskId == "" {
+		ctx.Logger.Fatal("usage: tasker stats <task> [--limit N]")
+	}
+	if !ctx.HasTaskDef(taskId) {
+		ctx.Logger.Fatal("no task found: ", taskId)
+	}
+
+	inRuns, ran, failed := 0, 0, 0
+	durations := []time.Duration{}
+	lastResult, lastRunId := "", ""
+	for _, run := range readHistory(ctx, targs.Limit) {
+		for _, task := range run.Tasks {
+			if task.TaskId != taskId {
+				continue
+			}
+			inRuns++
+			lastResult, lastRunId = task.Result, run.RunId
+			// Interrupted runs say nothing about how long the task takes or whether it works
+			if !task.Ran() || task.Result == string(tasker.Interrupted) {
+				continue
+			}
+			ran++
+			durations = append(durations, task.Duration())
+			if task.Result == string(tasker.Failure) || task.Result == string(tasker.TimedOut) {
+				failed++
+			}
+		}
+	}
+
+	fmt.Println("task:     ", taskId)
+	fmt.Printf("runs:      %d (ran in %d)\n", inRuns, ran)
+	if inRuns == 0 {
+		return
+	}
+	fmt.Printf("last:      %s (%s)\n", lastResult, lastRunId)
+	if ran == 0 {
+		return
+	}
+	fmt.Printf("failures:  %d/%d (%.1f%%)\n", failed, ran, 100*float64(failed)/float64(ran))
+	fmt.Printf("duration:  p50 %dms, p95 %dms\n", percentile(durations, 50).Milliseconds(), percentile(durations, 95).Milliseconds())
+}
+
+// percentile returns the nearest-rank percentile of the durations, zero if there are none
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
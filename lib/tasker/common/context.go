@@ -34,15 +34,20 @@ func (ctx Context) GetAllTaskDefs() []defs.TaskDefinition {
 	return allTasks
 }
 
-func (ctx Context) GetProjectDef(projectId defs.ProjectId) defs.ProjectDefinition {
-	for _, project := range ctx.Workspace.Definition.Projects {
-		if project.Id == projectId {
-			return project
-		}
-	}
+func (ctx Context) GetTaskDef(taskId defs.TaskId) defs.TaskDefinition {
+	return ctx.Workspace.Definition.GetTask(taskId)
+}
+
+func (ctx Context) HasTaskDef(taskId defs.TaskId) bool {
+	return ctx.Workspace.Definition.HasTask(taskId)
+}
 
-	log.Fatal("Project not found: ", projectId)
-	return defs.ProjectDefinition{}
+func (ctx Context) HasProjectDef(projectId defs.ProjectId) bool {
+	return ctx.Workspace.Definition.HasProject(projectId)
+}
+
+func (ctx Context) GetProjectDef(projectId defs.ProjectId) defs.ProjectDefinition {
+	return ctx.Workspace.Definition.GetProject(projectId)
 }
 
 // TODO: Spread the inner structs
@@ -54,6 +59,10 @@ func (ctx Context) GetProjectState(projectId defs.ProjectId) state.ProjectPersis
 	return ctx.Workspace.State.GetProjectState(projectId)
 }
 
+func (ctx Context) GetTaskState(taskId defs.TaskId) state.TaskPersistentState {
+	return ctx.GetProjectState(ctx.MapTaskToProject(taskId).Id).GetTaskState(taskId)
+}
+
 //
 // END: Utility accessors / helpers
 //
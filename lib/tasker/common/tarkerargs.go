@@ -1,33 +1,195 @@
 package common
 
 import (
+	"flag"
+	"fmt"
 	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker/output"
 	"os"
+	"runtime"
 	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Commands other than running tasks, ex. "tasker init"
+// NOTE: A project can't be targeted by "tasker <project>" if its id is the same as a command, use "tasker run <project>"
+const (
+	RunCommand      = "run" // the default, can be left out
+	InitCommand     = "init"
+	LogsCommand     = "logs"
+	HistoryCommand  = "history"
+	StatsCommand    = "stats"
+	GraphCommand    = "graph"
+	ListCommand     = "list"
+	DescribeCommand = "describe"
+)
+
+var commands = []string{RunCommand, InitCommand, LogsCommand, HistoryCommand, StatsCommand, GraphCommand, ListCommand, DescribeCommand}
+
+// Formats the run report can be written in
+const (
+	TableReportFormat = "table" // the default, meant for reading in the terminal
+	JsonReportFormat  = "json"
+	JunitReportFormat = "junit"
 )
 
+var reportFormats = []string{TableReportFormat, JsonReportFormat, JunitReportFormat}
+
 type TaskerArgs struct {
+	// ex. "init", RunCommand if none given
+	Command string
+	// ex. "assets::set_env" or "assets", resolved into ProjectId/TaskId by ResolveTarget
+	// Commands other than RunCommand may take no target
+	Target string
 	// ex. "assets"
 	ProjectId defs.ProjectId
 	// ex. "assets::set_env"
+	// Empty if the whole project was targeted, aka "tasker assets"
 	TaskId defs.TaskId
 	// ex. "foo=bar"
 	Arguments []string
 	// ex. "tasker assets::set_env foo=bar"
 	AsRawString string
+
+	//
+	// Flags
+	//
+
+	// ex. "--root /path/to/workspace", empty to discover the root
+	Root string
+	// ex. "--jobs 4", max tasks running at once, defaults to the cpu count
+	Jobs int
+	// ex. "--keep-going", on failure block only the dependents of the failed task and carry on with the rest
+	KeepGoing bool
+	// ex. "--dry-run", print what would run and why instead of running it
+	DryRun bool
+	// ex. "--output grouped", how task output is shown on the console
+	Output output.Mode
+	// ex. "--report-format json", see reportFormats
+	ReportFormat string
+	// ex. "--report-file report.json", write the report there instead of printing it
+	ReportFile string
+	// ex. "--trace out.json", write a chrome trace of the run there
+	Trace string
+	// ex. "--run 20230401-120000-abcd", `tasker logs` of a specific run instead of the latest
+	Run string
+	// ex. "--follow", `tasker logs` keeps printing what gets appended
+	Follow bool
+	// ex. "--list", `tasker logs` lists the run ids of the kept logs instead
+	List bool
+	// ex. "--limit 50", how many past runs `tasker history` and `tasker stats` look at, 0 for all
+	Limit int
+	// ex. "--format mermaid", the format `tasker graph` writes the graph in
+	Format string
+	// ex. "--annotate", `tasker graph` shows the conditions and last run results of tasks
+	Annotate bool
 }
 
-func ParseTaskerArgs(ctx Context, cliArgs []string) TaskerArgs {
-	if len(cliArgs) == 0 {
-		ctx.Logger.Fatal("no args passed to tasker")
+// ParseTaskerArgs parses the cli args, flags can be given before or after the target.
+// Everything after "--" is taken as args rather than flags, ex. "tasker assets::build -- --verbose".
+// The target can only be resolved once the workspace is loaded, see ResolveTarget.
+func ParseTaskerArgs(ctxLogger *log.Entry, cliArgs []string) TaskerArgs {
+	ctxLogger.Debug("tasker args: ", cliArgs)
+	targs := TaskerArgs{
+		AsRawString: strings.Join(os.Args, " "), // just put it all back together
 	}
 
-	ctx.Logger.Debug("tasker args: ", cliArgs)
-	project := strings.Split(cliArgs[0], "::")[0]
-	return TaskerArgs{
-		ProjectId:   defs.ProjectId(project),
-		TaskId:      defs.TaskId(cliArgs[0]),
-		Arguments:   cliArgs[1:],
-		AsRawString: strings.Join(os.Args, " "), // just put it all back together
+	flags := flag.NewFlagSet("tasker", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: tasker [command] <target> [flags] [-- args that aren't flags]")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&targs.Root, "root", "", "workspace root, by default found from the cwd or $TASKER_ROOT")
+	flags.IntVar(&targs.Jobs, "jobs", runtime.NumCPU(), "max tasks running at once")
+	flags.IntVar(&targs.Jobs, "j", runtime.NumCPU(), "shorthand for --jobs")
+	flags.BoolVar(&targs.KeepGoing, "keep-going", false, "on failure keep running all tasks that don't depend on the failed one")
+	flags.BoolVar(&targs.KeepGoing, "k", false, "shorthand for --keep-going")
+	flags.BoolVar(&targs.DryRun, "dry-run", false, "print the waves of tasks that would run and why, without running them")
+	outputMode := flags.String("output", string(output.Interleaved), "task output on the console: interleaved, grouped or failures")
+	flags.StringVar(&targs.ReportFormat, "report-format", TableReportFormat, "run report format: table, json or junit")
+	flags.StringVar(&targs.ReportFile, "report-file", "", "write the run report to this file, the table is still printed")
+	flags.StringVar(&targs.Trace, "trace", "", "write a chrome trace of the run to this file, to open in Perfetto")
+	flags.StringVar(&targs.Run, "run", "", "logs: the run id to show the log of, defaults to the latest")
+	flags.BoolVar(&targs.Follow, "follow", false, "logs: keep printing what gets appended to the log")
+	flags.BoolVar(&targs.Follow, "f", false, "shorthand for --follow")
+	flags.BoolVar(&targs.List, "list", false, "logs: list the run ids of the kept logs")
+	flags.StringVar(&targs.Format, "format", "dot", "graph: the format of the graph, dot, mermaid or json")
+	flags.BoolVar(&targs.Annotate, "annotate", false, "graph: show the conditions and last run results of tasks")
+	flags.IntVar(&targs.Limit, "limit", 20, "history, stats: how many of the latest runs to look at, 0 for all")
+	positional := parseInterleaved(flags, cliArgs)
+
+	if targs.Jobs < 1 {
+		ctxLogger.Fatal("--jobs must be at least 1, got: ", targs.Jobs)
+	}
+	mode, err := output.ParseMode(*outputMode)
+	if err != nil {
+		ctxLogger.Fatal("--output: ", err)
+	}
+	targs.Output = mode
+	if !contains(reportFormats, targs.ReportFormat) {
+		ctxLogger.Fatal("--report-format must be one of ", reportFormats, ", got: ", targs.ReportFormat)
+	}
+
+	targs.Command = RunCommand
+	if len(positional) != 0 && isCommand(positional[0]) {
+		targs.Command = positional[0]
+		positional = positional[1:]
+	}
+
+	if len(positional) == 0 {
+		if targs.Command == RunCommand {
+			ctxLogger.Fatal("no args passed to tasker")
+		}
+		return targs
+	}
+	targs.Target = positional[0]
+	targs.Arguments = positional[1:]
+	return targs
+}
+
+// ResolveTarget resolves the target into either a task ("assets::build") or a whole project ("assets")
+func (targs *TaskerArgs) ResolveTarget(ctx Context) {
+	if ctx.HasTaskDef(defs.TaskId(targs.Target)) {
+		targs.TaskId = defs.TaskId(targs.Target)
+		targs.ProjectId = ctx.MapTaskToProject(targs.TaskId).Id
+	} else if ctx.HasProjectDef(defs.ProjectId(targs.Target)) {
+		targs.ProjectId = defs.ProjectId(targs.Target)
+	} else {
+		ctx.Logger.Fatal("no task or project found for target: ", targs.Target)
+	}
+}
+
+func isCommand(arg string) bool {
+	return contains(commands, arg)
+}
+
+func contains(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInterleaved parses flags wherever they are in the args and returns the positional args in order
+func parseInterleaved(flags *flag.FlagSet, args []string) []string {
+	positional := []string{}
+	for {
+		// Parse stops at the first positional arg (or "--"), so collect it and carry on after it
+		flags.Parse(args) // ExitOnError, so no error to handle
+		rest := flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		// "--" ends flag parsing for good, everything after it is positional
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
 	}
+	return positional
 }
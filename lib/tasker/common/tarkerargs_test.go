@@ -0,0 +1,39 @@
+package common
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestParseInterleaved(t *testing.T) {
+	tests := []struct {
+		args           []string
+		wantPositional []string
+		wantJobs       int
+		wantKeepGoing  bool
+	}{
+		{args: []string{}, wantPositional: []string{}, wantJobs: 1},
+		{args: []string{"assets::build"}, wantPositional: []string{"assets::build"}, wantJobs: 1},
+		{args: []string{"-j", "4", "assets::build"}, wantPositional: []string{"assets::build"}, wantJobs: 4},
+		{args: []string{"assets::build", "--jobs=4", "-k"}, wantPositional: []string{"assets::build"}, wantJobs: 4, wantKeepGoing: true},
+		{args: []string{"logs", "-k", "assets::build", "-j", "2"}, wantPositional: []string{"logs", "assets::build"}, wantJobs: 2, wantKeepGoing: true},
+		{args: []string{"run", "assets::build", "--", "-k", "x"}, wantPositional: []string{"run", "assets::build", "-k", "x"}, wantJobs: 1},
+		{args: []string{"--", "-j", "3"}, wantPositional: []string{"-j", "3"}, wantJobs: 1},
+		{args: []string{"-j", "2", "assets::build", "--", "--unknown", "-x=1", "--"}, wantPositional: []string{"assets::build", "--unknown", "-x=1", "--"}, wantJobs: 2},
+	}
+	for _, test := range tests {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		jobs := flags.Int("jobs", 1, "")
+		flags.IntVar(jobs, "j", 1, "")
+		keepGoing := flags.Bool("k", false, "")
+
+		positional := parseInterleaved(flags, test.args)
+		if strings.Join(positional, " ") != strings.Join(test.wantPositional, " ") {
+			t.Errorf("%v: got positional %q, want %q", test.args, positional, test.wantPositional)
+		}
+		if *jobs != test.wantJobs || *keepGoing != test.wantKeepGoing {
+			t.Errorf("%v: got jobs %d keep-going %v, want %d %v", test.args, *jobs, *keepGoing, test.wantJobs, test.wantKeepGoing)
+		}
+	}
+}
@@ -42,7 +42,8 @@ func NewWorkspace(workspaceDef defs.WorkspaceDefinition) Workspace {
 // BROKEN
 func (ws Workspace) GetEnv() string {
 	defaultEnv := "# default env\n"
-	defaultEnv += "export ws_root_path=" + lib.WsRootPath + "\n"
+	defaultEnv += "export ws_root_path=" + lib.ShellQuote(lib.WsRootPath) + "\n"
+	defaultEnv += "export " + lib.WsRootEnvVar + "=" + lib.ShellQuote(lib.WsRootPath) + "\n" // so nested tasker bins find the same root
 
 	// check if env file exists
 	if _, err := os.Stat(ws.Definition.EnvFilePath); os.IsNotExist(err) {
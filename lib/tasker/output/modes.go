@@ -0,0 +1,96 @@
+package output
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How task output is shown on the console, the log files always get all of it
+type Mode string
+
+const (
+	// Lines of all tasks as they come in, prefixed with the task
+	Interleaved Mode = "interleaved"
+	// All output of a task at once when it ends, so parallel tasks don't mix
+	Grouped Mode = "grouped"
+	// Like grouped, but only the output of tasks that failed, failed attempts that get retried don't count
+	Failures Mode = "failures"
+)
+
+var Modes = []Mode{Interleaved, Grouped, Failures}
+
+// Most lines held back per task in grouped modes, the latest are kept and the earlier ones are only in the log
+const MaxGroupedLines = 10000
+
+// ParseMode returns the mode for the given name, or an error if there is no such mode
+func ParseMode(name string) (Mode, error) {
+	for _, mode := range Modes {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output mode: %s, expected one of: %v", name, Modes)
+}
+
+// NewModeSink returns the console sink for the mode
+// logPath is pointed to when output had to be cut short, retriesLeft tells if a failure of the task is going to be retried.
+func NewModeSink(mode Mode, logPath string, retriesLeft bool) Sink {
+	switch mode {
+	case Grouped:
+		return &GroupedSink{logPath: logPath, onlyFailures: false}
+	case Failures:
+		return &GroupedSink{logPath: logPath, onlyFailures: true, retriesLeft: retriesLeft}
+	default:
+		return NewConsoleSink()
+	}
+}
+
+// Held while printing a group, so groups of tasks ending at once don't mix
+var groupPrintMutex sync.Mutex
+
+// GroupedSink holds back the output of a task and prints it at once when the task ends
+type GroupedSink struct {
+	logPath      string
+	onlyFailures bool
+	// A failure is retried, so not a failure of the task yet
+	retriesLeft bool
+	// Ring of the latest MaxGroupedLines lines, next is where the next line goes once it is full
+	lines []Line
+	next  int
+	// Earlier lines overwritten in the ring
+	dropped int
+}
+
+func (s *GroupedSink) WriteLine(line Line) {
+	if len(s.lines) < MaxGroupedLines {
+		s.lines = append(s.lines, line)
+		return
+	}
+	s.lines[s.next] = line
+	s.next = (s.next + 1) % MaxGroupedLines
+	s.dropped++
+}
+
+// lock: r/w
+func (s *GroupedSink) End(err error) {
+	if s.onlyFailures && (err == nil || s.retriesLeft) {
+		return
+	}
+	if len(s.lines) == 0 {
+		return
+	}
+
+	groupPrintMutex.Lock()
+	defer groupPrintMutex.Unlock()
+	if s.dropped > 0 {
+		log.Warnf("[task=%s] %d earlier lines in %s", string(s.lines[0].TaskId), s.dropped, s.logPath)
+	}
+	console := NewConsoleSink()
+	for i := range s.lines {
+		console.WriteLine(s.lines[(s.next+i)%len(s.lines)])
+	}
+	s.lines = nil
+	s.next = 0
+}
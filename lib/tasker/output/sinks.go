@@ -0,0 +1,83 @@
+package output
+
+import (
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ConsoleSink logs each line prefixed with the task, as lines come in
+type ConsoleSink struct{}
+
+func NewConsoleSink() *ConsoleSink {
+	return &ConsoleSink{}
+}
+
+func (s *ConsoleSink) WriteLine(line Line) {
+	// Blank lines only make interleaved output of parallel tasks harder to read
+	if strings.TrimSpace(line.Text) == "" {
+		return
+	}
+	if line.Stream == Stderr {
+		log.Infof("[task=%s][stderr] %s", string(line.TaskId), line.Text)
+		return
+	}
+	log.Infof("[task=%s] %s", string(line.TaskId), line.Text)
+}
+
+func (s *ConsoleSink) End(err error) {}
+
+// WriterSink writes the lines as they are to a writer, ex. the tasks log file
+// Writing stops at the first error, which End logs.
+type WriterSink struct {
+	writer io.Writer
+	err    error
+}
+
+func NewWriterSink(writer io.Writer) *WriterSink {
+	return &WriterSink{writer: writer}
+}
+
+func (s *WriterSink) WriteLine(line Line) {
+	if s.err != nil {
+		return
+	}
+	_, s.err = io.WriteString(s.writer, line.Text+"\n")
+}
+
+func (s *WriterSink) End(err error) {
+	if s.err != nil {
+		log.Warn("failed to write task output: ", s.err)
+	}
+}
+
+// TailSink keeps the last lines of output, ex. to show with a failure
+type TailSink struct {
+	maxLines int
+	lines    []string
+}
+
+func NewTailSink(maxLines int) *TailSink {
+	return &TailSink{maxLines: maxLines, lines: []string{}}
+}
+
+func (s *TailSink) WriteLine(line Line) {
+	if s.maxLines <= 0 {
+		return
+	}
+	if len(s.lines) == s.maxLines {
+		s.lines = s.lines[1:]
+	}
+	s.lines = append(s.lines, line.Text)
+}
+
+func (s *TailSink) End(err error) {}
+
+// String returns the kept lines joined back together
+func (s *TailSink) String() string {
+	if len(s.lines) == 0 {
+		return ""
+	}
+	return strings.Join(s.lines, "\n") + "\n"
+}
@@ -0,0 +1,135 @@
+package output
+
+import (
+	"bytes"
+	"inference-tasker/lib/defs"
+	"io"
+	"sync"
+)
+
+// Longest line kept in memory, longer lines are passed on in pieces of this size
+const MaxLineLength = 64 * 1024
+
+type StreamKind string
+
+const (
+	Stdout StreamKind = "stdout"
+	Stderr StreamKind = "stderr"
+)
+
+// A single line of task output, without the line ending
+type Line struct {
+	TaskId defs.TaskId
+	Stream StreamKind
+	Text   string
+}
+
+// Sink consumes the output lines of a task, ex. the console or the tasks log file
+// Lines are passed to a sink one at a time, in the order they were captured.
+type Sink interface {
+	WriteLine(line Line)
+	// End is called once after the last line, with the error the task finished with
+	End(err error)
+}
+
+// Capture splits the stdout and stderr of a task into lines and passes them on to its sinks
+// Only the current partial line of each stream is held in memory.
+type Capture struct {
+	taskId defs.TaskId
+	sinks  []Sink
+	stdout *lineWriter
+	stderr *lineWriter
+	ended  bool
+	// lock: r/w for everything above, keeps the lines of both streams ordered
+	mutex sync.Mutex
+}
+
+func NewCapture(taskId defs.TaskId, sinks ...Sink) *Capture {
+	capture := &Capture{taskId: taskId, sinks: sinks}
+	capture.stdout = &lineWriter{capture: capture, stream: Stdout}
+	capture.stderr = &lineWriter{capture: capture, stream: Stderr}
+	return capture
+}
+
+// Stdout returns the writer to give the task as its stdout
+func (c *Capture) Stdout() io.Writer {
+	return c.stdout
+}
+
+// Stderr returns the writer to give the task as its stderr
+func (c *Capture) Stderr() io.Writer {
+	return c.stderr
+}
+
+// End passes on what is left of unterminated lines and ends all sinks
+// Anything written after End is dropped.
+// lock: r/w
+func (c *Capture) End(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.ended {
+		return
+	}
+	c.stdout.flush()
+	c.stderr.flush()
+	for _, sink := range c.sinks {
+		sink.End(err)
+	}
+	c.ended = true
+}
+
+// mut: true
+type lineWriter struct {
+	capture *Capture
+	stream  StreamKind
+	// The line written so far, without a line ending yet
+	partial []byte
+}
+
+// lock: r/w via capture
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.capture.mutex.Lock()
+	defer lw.capture.mutex.Unlock()
+	if lw.capture.ended {
+		return len(p), nil
+	}
+
+	rest := p
+	for len(rest) > 0 {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			lw.partial = append(lw.partial, rest...)
+			break
+		}
+		lw.partial = append(lw.partial, rest[:i]...)
+		lw.emit()
+		rest = rest[i+1:]
+	}
+	// Keep memory bounded even if a task never ends its lines
+	for len(lw.partial) >= MaxLineLength {
+		piece := lw.partial[:MaxLineLength]
+		lw.partial = lw.partial[MaxLineLength:]
+		lw.emitText(string(piece))
+	}
+	return len(p), nil
+}
+
+// flush passes on the unterminated line, if any
+func (lw *lineWriter) flush() {
+	if len(lw.partial) > 0 {
+		lw.emit()
+	}
+}
+
+func (lw *lineWriter) emit() {
+	text := string(bytes.TrimSuffix(lw.partial, []byte("\r")))
+	lw.partial = lw.partial[:0]
+	lw.emitText(text)
+}
+
+func (lw *lineWriter) emitText(text string) {
+	line := Line{TaskId: lw.capture.taskId, Stream: lw.stream, Text: text}
+	for _, sink := range lw.capture.sinks {
+		sink.WriteLine(line)
+	}
+}
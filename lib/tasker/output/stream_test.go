@@ -0,0 +1,114 @@
+package output
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// recordingSink keeps everything passed to it
+type recordingSink struct {
+	lines []Line
+	ends  []error
+}
+
+func (s *recordingSink) WriteLine(line Line) {
+	s.lines = append(s.lines, line)
+}
+
+func (s *recordingSink) End(err error) {
+	s.ends = append(s.ends, err)
+}
+
+func TestCapture(t *testing.T) {
+	long := strings.Repeat("x", MaxLineLength)
+	tests := []struct {
+		name string
+		// Written in order, "out:" or "err:" picks the stream
+		writes []string
+		want   []string
+	}{
+		{name: "whole lines", writes: []string{"out:a\nb\n"}, want: []string{"stdout a", "stdout b"}},
+		{name: "lines split across writes", writes: []string{"out:he", "out:llo\nwor", "out:ld\n"}, want: []string{"stdout hello", "stdout world"}},
+		{name: "unterminated last line", writes: []string{"out:a\nb"}, want: []string{"stdout a", "stdout b"}},
+		{name: "crlf line endings", writes: []string{"out:a\r\nb\r\n"}, want: []string{"stdout a", "stdout b"}},
+		{name: "empty lines", writes: []string{"out:\n\na\n"}, want: []string{"stdout ", "stdout ", "stdout a"}},
+		{
+			name:   "streams keep their own partial lines",
+			writes: []string{"out:o", "err:e1\n", "out:ut\n", "err:e2"},
+			want:   []string{"stderr e1", "stdout out", "stderr e2"},
+		},
+		{
+			name:   "too long unterminated lines are passed on in pieces",
+			writes: []string{"out:" + long + "x", "out:tail\n"},
+			want:   []string{"stdout " + long, "stdout xtail"},
+		},
+	}
+	for _, test := range tests {
+		sink := &recordingSink{}
+		capture := NewCapture("prj::task", sink)
+		for _, write := range test.writes {
+			stream, text, _ := strings.Cut(write, ":")
+			writer := capture.Stdout()
+			if stream == "err" {
+				writer = capture.Stderr()
+			}
+			if n, err := writer.Write([]byte(text)); n != len(text) || err != nil {
+				t.Fatalf("%s: wrote %d of %d bytes, err: %v", test.name, n, len(text), err)
+			}
+		}
+		capture.End(nil)
+
+		got := []string{}
+		for _, line := range sink.lines {
+			if line.TaskId != "prj::task" {
+				t.Errorf("%s: line of task %s", test.name, line.TaskId)
+			}
+			got = append(got, string(line.Stream)+" "+line.Text)
+		}
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%s: got lines %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCaptureEnd(t *testing.T) {
+	first, second := &recordingSink{}, &recordingSink{}
+	capture := NewCapture("prj::task", first, second)
+	capture.Stdout().Write([]byte("before"))
+	taskErr := errors.New("exit status 1")
+	capture.End(taskErr)
+	capture.Stdout().Write([]byte("after\n"))
+	capture.End(nil)
+
+	for _, sink := range []*recordingSink{first, second} {
+		if len(sink.lines) != 1 || sink.lines[0].Text != "before" {
+			t.Errorf("got lines %v, want only the one ended before End", sink.lines)
+		}
+		if len(sink.ends) != 1 || sink.ends[0] != taskErr {
+			t.Errorf("got ends %v, want End once with the task error", sink.ends)
+		}
+	}
+}
+
+func TestTailSink(t *testing.T) {
+	tests := []struct {
+		maxLines int
+		lines    []string
+		want     string
+	}{
+		{maxLines: 2, lines: []string{}, want: ""},
+		{maxLines: 2, lines: []string{"a"}, want: "a\n"},
+		{maxLines: 2, lines: []string{"a", "b", "c"}, want: "b\nc\n"},
+		{maxLines: 0, lines: []string{"a"}, want: ""},
+	}
+	for _, test := range tests {
+		sink := NewTailSink(test.maxLines)
+		for _, text := range test.lines {
+			sink.WriteLine(Line{Text: text})
+		}
+		if got := sink.String(); got != test.want {
+			t.Errorf("tail of %d of %v: got %q, want %q", test.maxLines, test.lines, got, test.want)
+		}
+	}
+}
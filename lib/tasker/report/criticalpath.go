@@ -0,0 +1,62 @@
+package report
+
+import (
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker"
+	"inference-tasker/lib/tasker/common"
+	"time"
+)
+
+// CriticalPath returns the chain of tasks that decided how long the run took, first task first
+// It starts from the task that finished last and walks back through the dep that finished last, each
+// task on it waited for the one before it. Only tasks that finished are on it, ones that didn't run (ex. cached)
+// took no time and interrupted ones only ran for as long as it took to stop them.
+func CriticalPath(ctx common.Context, result tasker.RunnerRunResult) []defs.TaskId {
+	ran := map[defs.TaskId]tasker.TaskRunResult{}
+	var last *tasker.TaskRunResult
+	for i, taskResult := range result.TaskRunResults {
+		if !taskResult.Finished() {
+			continue
+		}
+		ran[taskResult.TaskId] = taskResult
+		if last == nil || taskResult.EndTime.After(last.EndTime) {
+			last = &result.TaskRunResults[i]
+		}
+	}
+	if last == nil {
+		return []defs.TaskId{}
+	}
+
+	path := []defs.TaskId{last.TaskId}
+	current := *last
+	for {
+		var blocker *tasker.TaskRunResult
+		for _, dep := range ctx.GetTaskDef(current.TaskId).Deps {
+			depResult, ok := ran[dep]
+			if ok && (blocker == nil || depResult.EndTime.After(blocker.EndTime)) {
+				blocker = &depResult
+			}
+		}
+		if blocker == nil {
+			break
+		}
+		path = append([]defs.TaskId{blocker.TaskId}, path...)
+		current = *blocker
+	}
+	return path
+}
+
+// CriticalPathTaken returns how long the tasks on the critical path ran for in total
+func CriticalPathTaken(result tasker.RunnerRunResult, path []defs.TaskId) time.Duration {
+	onPath := map[defs.TaskId]bool{}
+	for _, taskId := range path {
+		onPath[taskId] = true
+	}
+	taken := time.Duration(0)
+	for _, taskResult := range result.TaskRunResults {
+		if onPath[taskResult.TaskId] {
+			taken += taskResult.EndTime.Sub(taskResult.StartTime)
+		}
+	}
+	return taken
+}
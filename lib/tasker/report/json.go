@@ -0,0 +1,86 @@
+package report
+
+import (
+	"encoding/json"
+	"inference-tasker/lib/tasker"
+	"inference-tasker/lib/tasker/common"
+	"time"
+)
+
+type jsonReport struct {
+	RunId      string    `json:"runId"`
+	StartTime  time.Time `json:"startTime"`
+	EndTime    time.Time `json:"endTime"`
+	DurationMs int64     `json:"durationMs"`
+	// Tasks that decided how long the run took, first task first, see CriticalPath
+	CriticalPath []string   `json:"criticalPath"`
+	Tasks        []jsonTask `json:"tasks"`
+}
+
+type jsonTask struct {
+	TaskId    string     `json:"taskId"`
+	Project   string     `json:"project"`
+	Result    string     `json:"result"`
+	StartTime *time.Time `json:"startTime,omitempty"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+	// Only set for tasks that ran
+	DurationMs *int64 `json:"durationMs,omitempty"`
+	// Exit status of the last attempt, only set for tasks that ran
+	ExitCode *int          `json:"exitCode,omitempty"`
+	Attempts []jsonAttempt `json:"attempts"`
+	LogPath  string        `json:"logPath,omitempty"`
+}
+
+type jsonAttempt struct {
+	StartTime  time.Time `json:"startTime"`
+	EndTime    time.Time `json:"endTime"`
+	DurationMs int64     `json:"durationMs"`
+	ExitCode   int       `json:"exitCode"`
+}
+
+// BuildJson serializes the run result as json, one entry per task
+func BuildJson(ctx common.Context, result tasker.RunnerRunResult) (string, error) {
+	report := jsonReport{
+		RunId:        result.RunId,
+		StartTime:    result.StartTime,
+		EndTime:      result.EndTime,
+		DurationMs:   result.Taken(),
+		CriticalPath: []string{},
+		Tasks:        []jsonTask{},
+	}
+	for _, taskId := range CriticalPath(ctx, result) {
+		report.CriticalPath = append(report.CriticalPath, string(taskId))
+	}
+	for _, taskResult := range result.TaskRunResults {
+		task := jsonTask{
+			TaskId:   string(taskResult.TaskId),
+			Project:  string(ctx.MapTaskToProject(taskResult.TaskId).Id),
+			Result:   string(taskResult.Result),
+			Attempts: []jsonAttempt{},
+			LogPath:  taskResult.LogPath,
+		}
+		if !taskResult.StartTime.IsZero() && !taskResult.EndTime.IsZero() {
+			startTime, endTime := taskResult.StartTime, taskResult.EndTime
+			duration := endTime.Sub(startTime).Milliseconds()
+			task.StartTime, task.EndTime, task.DurationMs = &startTime, &endTime, &duration
+		}
+		if exitStatus, ok := taskResult.ExitStatus(); ok {
+			task.ExitCode = &exitStatus
+		}
+		for _, attempt := range taskResult.Attempts {
+			task.Attempts = append(task.Attempts, jsonAttempt{
+				StartTime:  attempt.StartTime,
+				EndTime:    attempt.EndTime,
+				DurationMs: attempt.EndTime.Sub(attempt.StartTime).Milliseconds(),
+				ExitCode:   attempt.ExitStatus,
+			})
+		}
+		report.Tasks = append(report.Tasks, task)
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(content) + "\n", nil
+}
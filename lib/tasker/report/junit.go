@@ -0,0 +1,112 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"inference-tasker/lib/tasker"
+	"inference-tasker/lib/tasker/common"
+	"os"
+)
+
+// Most of a failed tasks log embedded in the junit report, CI only needs the end of it
+const maxJunitLogBytes = 64 * 1024
+
+type junitTestSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// BuildJunit serializes the run result as a junit report, one testcase per task with the project as class
+// Failed tasks carry the end of their log, tasks that didn't run are skipped.
+func BuildJunit(ctx common.Context, result tasker.RunnerRunResult) (string, error) {
+	suite := junitSuite{
+		Name:      "tasker " + result.RunId,
+		Time:      seconds(result.Taken()),
+		Timestamp: result.StartTime.Format("2006-01-02T15:04:05"),
+		Cases:     []junitCase{},
+	}
+	for _, taskResult := range result.TaskRunResults {
+		testCase := junitCase{
+			Name:      string(taskResult.TaskId),
+			Classname: string(ctx.MapTaskToProject(taskResult.TaskId).Id),
+			Time:      "0",
+		}
+		if !taskResult.StartTime.IsZero() && !taskResult.EndTime.IsZero() {
+			testCase.Time = seconds(taskResult.EndTime.Sub(taskResult.StartTime).Milliseconds())
+		}
+
+		switch taskResult.Result {
+		case tasker.Success:
+			if taskResult.PassedOnRetry() {
+				testCase.SystemOut = fmt.Sprintf("passed on attempt %d", len(taskResult.Attempts))
+			}
+		case tasker.Failure, tasker.TimedOut:
+			exitStatus, _ := taskResult.ExitStatus()
+			testCase.Failure = &junitMessage{
+				Message: fmt.Sprintf("%s, exit code %d, attempts %d", taskResult.Result, exitStatus, len(taskResult.Attempts)),
+				Body:    readLogTail(taskResult.LogPath),
+			}
+			suite.Failures++
+		case tasker.Interrupted:
+			testCase.Error = &junitMessage{Message: string(taskResult.Result)}
+			suite.Errors++
+		default:
+			testCase.Skipped = &junitMessage{Message: string(taskResult.Result)}
+			suite.Skipped++
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+	}
+
+	content, err := xml.MarshalIndent(junitTestSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(content) + "\n", nil
+}
+
+func seconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+// readLogTail returns the end of a task log, or a note why it can't
+func readLogTail(logPath string) string {
+	if logPath == "" {
+		return ""
+	}
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		return "failed to read log " + logPath + ": " + err.Error()
+	}
+	if len(content) > maxJunitLogBytes {
+		content = content[len(content)-maxJunitLogBytes:]
+	}
+	return "log: " + logPath + "\n" + string(content)
+}
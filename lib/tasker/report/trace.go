@@ -0,0 +1,107 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker"
+	"inference-tasker/lib/tasker/common"
+	"sort"
+	"time"
+)
+
+// Chrome trace event format, see https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceFile struct {
+	TraceEvents     []traceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+type traceEvent struct {
+	Name string `json:"name"`
+	Cat  string `json:"cat,omitempty"`
+	// "X" for a complete event with a duration, "M" for metadata like lane names
+	Ph  string `json:"ph"`
+	Ts  int64  `json:"ts"` // microseconds since the run began
+	Dur int64  `json:"dur,omitempty"`
+	Pid int    `json:"pid"`
+	Tid int    `json:"tid"`
+	// Shown when the event is selected
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// BuildTrace serializes the run as a chrome trace, to open in Perfetto or chrome://tracing
+// Every attempt of every task that ran is an event, laid out in lanes so tasks running at once don't overlap.
+// Tasks on the critical path are in the "critical" category.
+func BuildTrace(ctx common.Context, result tasker.RunnerRunResult) (string, error) {
+	onPath := map[defs.TaskId]bool{}
+	for _, taskId := range CriticalPath(ctx, result) {
+		onPath[taskId] = true
+	}
+
+	ranResults := []tasker.TaskRunResult{}
+	for _, taskResult := range result.TaskRunResults {
+		if !taskResult.StartTime.IsZero() && !taskResult.EndTime.IsZero() {
+			ranResults = append(ranResults, taskResult)
+		}
+	}
+	sort.SliceStable(ranResults, func(i, j int) bool {
+		return ranResults[i].StartTime.Before(ranResults[j].StartTime)
+	})
+
+	events := []traceEvent{{
+		Name: "process_name", Ph: "M", Pid: 1,
+		Args: map[string]interface{}{"name": "tasker " + result.RunId},
+	}}
+	// Each lane is free again at its end time
+	laneEnds := []time.Time{}
+	for _, taskResult := range ranResults {
+		lane := -1
+		for i, laneEnd := range laneEnds {
+			if !laneEnd.After(taskResult.StartTime) {
+				lane = i
+				break
+			}
+		}
+		if lane == -1 {
+			lane = len(laneEnds)
+			laneEnds = append(laneEnds, time.Time{})
+			events = append(events, traceEvent{
+				Name: "thread_name", Ph: "M", Pid: 1, Tid: lane + 1,
+				Args: map[string]interface{}{"name": fmt.Sprintf("lane %d", lane+1)},
+			})
+		}
+		laneEnds[lane] = taskResult.EndTime
+
+		cat := string(ctx.MapTaskToProject(taskResult.TaskId).Id)
+		if onPath[taskResult.TaskId] {
+			cat = "critical," + cat
+		}
+		for i, attempt := range taskResult.Attempts {
+			name := string(taskResult.TaskId)
+			if len(taskResult.Attempts) > 1 {
+				name = fmt.Sprintf("%s (attempt %d)", name, i+1)
+			}
+			events = append(events, traceEvent{
+				Name: name,
+				Cat:  cat,
+				Ph:   "X",
+				Ts:   attempt.StartTime.Sub(result.StartTime).Microseconds(),
+				Dur:  attempt.EndTime.Sub(attempt.StartTime).Microseconds(),
+				Pid:  1,
+				Tid:  lane + 1,
+				Args: map[string]interface{}{
+					"result":     string(taskResult.Result),
+					"exitStatus": attempt.ExitStatus,
+					"critical":   onPath[taskResult.TaskId],
+					"log":        taskResult.LogPath,
+				},
+			})
+		}
+	}
+
+	content, err := json.MarshalIndent(traceFile{TraceEvents: events, DisplayTimeUnit: "ms"}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(content) + "\n", nil
+}
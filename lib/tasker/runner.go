@@ -1,19 +1,27 @@
 package tasker
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"inference-tasker/lib"
 	"inference-tasker/lib/defs"
+	"inference-tasker/lib/state"
 	"inference-tasker/lib/tasker/common"
+	"inference-tasker/lib/tasker/output"
 	"inference-tasker/lib/tasker/scheduler"
 	"inference-tasker/lib/tasker/skipper"
 	"inference-tasker/lib/tasker/tasks"
+	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// TODO: Add option to limit parallelism
 type Runner struct {
 	// Queue of tasks to execute
 	Queue chan *tasks.Task
@@ -21,12 +29,22 @@ type Runner struct {
 	Scheduler *scheduler.Scheduler
 	// TODO
 	Skipper skipper.Skipper
+	// Max tasks running at once
+	Jobs int
+	// Whether to carry on with tasks not depending on a failed task instead of stopping at the first failure
+	KeepGoing bool
+	// How task output is shown on the console
+	Output output.Mode
+	// ex. "tasker assets::build -k", persisted with the run history
+	RawArgs string
 	// Final results of runner run
 	RunResults      *RunnerRunResult
 	runResultsMutex sync.Mutex
 }
 
 type RunnerRunResult struct {
+	// ex. "20230401-120000-abcd", unique per run and sorts by start time
+	RunId          string
 	StartTime      time.Time
 	EndTime        time.Time
 	TaskRunResults []TaskRunResult
@@ -39,10 +57,13 @@ func (rr RunnerRunResult) Taken() int64 {
 type taskRunResult string
 
 const (
-	Success taskRunResult = "success"
-	Failure taskRunResult = "failure"
-	Cached  taskRunResult = "cached"
-	NotRun  taskRunResult = "not-run"
+	Success     taskRunResult = state.SuccessResult
+	Failure     taskRunResult = "failure"
+	Cached      taskRunResult = "cached"
+	NotRun      taskRunResult = "not-run"
+	Blocked     taskRunResult = "blocked"     // not run because a dep failed, with --keep-going
+	Interrupted taskRunResult = "interrupted" // stopped while running, ex. on ctrl-c or another tasks failure
+	TimedOut    taskRunResult = "timed-out"   // stopped for running past its timeout, counts as a failure
 )
 
 type TaskRunResult struct {
@@ -50,6 +71,34 @@ type TaskRunResult struct {
 	StartTime time.Time
 	EndTime   time.Time
 	Result    taskRunResult
+	// Every time the task was run, more than one if it was retried
+	Attempts []TaskAttempt
+	// Where the output of the task was written, empty if it didn't run
+	LogPath string
+}
+
+type TaskAttempt struct {
+	StartTime  time.Time
+	EndTime    time.Time
+	ExitStatus int
+}
+
+// PassedOnRetry returns true if the task only succeeded after failing at first
+func (trr TaskRunResult) PassedOnRetry() bool {
+	return trr.Result == Success && len(trr.Attempts) > 1
+}
+
+// Finished returns true if the task ran to its end, whether it succeeded or not
+func (trr TaskRunResult) Finished() bool {
+	return trr.Result == Success || trr.Result == Failure || trr.Result == TimedOut
+}
+
+// ExitStatus returns the exit status of the last attempt, false if the task didn't run
+func (trr TaskRunResult) ExitStatus() (int, bool) {
+	if len(trr.Attempts) == 0 {
+		return 0, false
+	}
+	return trr.Attempts[len(trr.Attempts)-1].ExitStatus, true
 }
 
 // TODO: These are report concerns, should be moved there
@@ -75,11 +124,15 @@ func (trr TaskRunResult) Taken() string {
 	return strconv.FormatInt(trr.EndTime.Sub(trr.StartTime).Milliseconds(), 10) + "ms"
 }
 
-func NewRunner(scheduler *scheduler.Scheduler, skipper skipper.Skipper) Runner {
+func NewRunner(scheduler *scheduler.Scheduler, skipper skipper.Skipper, args common.TaskerArgs) Runner {
 	return Runner{
 		Queue:           make(chan *tasks.Task),
 		Skipper:         skipper,
 		Scheduler:       scheduler,
+		Jobs:            args.Jobs,
+		KeepGoing:       args.KeepGoing,
+		Output:          args.Output,
+		RawArgs:         args.AsRawString,
 		RunResults:      nil,
 		runResultsMutex: sync.Mutex{},
 	}
@@ -89,6 +142,7 @@ func (r *Runner) Start(ctx *common.Context) RunnerRunResult {
 	log.Debug("starting runner")
 
 	r.RunResults = &RunnerRunResult{
+		RunId:          lib.NewRunId(),
 		StartTime:      time.Now(),
 		EndTime:        time.Time{},
 		TaskRunResults: []TaskRunResult{},
@@ -97,6 +151,38 @@ func (r *Runner) Start(ctx *common.Context) RunnerRunResult {
 	// Just cleanup. Signaling the end of work is not this, but instead done via nil task
 	defer close(r.Queue)
 
+	// Cancelling stops all running tasks and the queueing of new ones, on ctrl-c or a fatal failure
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// A second signal doesn't wait for the tasks to stop, it kills them and exits right away
+	stopSignals := make(chan os.Signal, 1)
+	signal.Notify(stopSignals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stopSignals)
+	runDone := make(chan struct{})
+	defer close(runDone)
+	go func() {
+		interrupted := false
+		for {
+			select {
+			case sig := <-stopSignals:
+				if !interrupted {
+					interrupted = true
+					log.Warn("received ", sig, ", interrupting all tasks, again to kill them right away")
+					cancel()
+					continue
+				}
+				log.Warn("received ", sig, " again, killing all tasks")
+				tasks.KillAll()
+				os.Exit(128 + int(sig.(syscall.Signal)))
+			case <-runDone:
+				return
+			}
+		}
+	}()
+
+	// Tasks are started as parallel as the deps allow, but only as far as the jobs limit and resource pools allow
+	slots := newSlots(r.Jobs, ctx.Workspace.Definition.Config.Pools)
+
 	// Spawn a goroutine that queue tasks based on scheduler's decisions
 	go func() {
 		defer func() {
@@ -104,33 +190,48 @@ func (r *Runner) Start(ctx *common.Context) RunnerRunResult {
 			r.Queue <- nil
 		}()
 		for {
-			// We always act as any failure is fatal
-			if r.Scheduler.AnyFailed() {
+			// Unless keeping going any failure is fatal, otherwise the scheduler blocks the dependents of failed tasks
+			if r.Scheduler.AnyFailed() && !r.KeepGoing {
 				log.Error("failed tasks, exiting queueing loop!")
 				break
 			}
+			if cancelCtx.Err() != nil {
+				log.Error("interrupted, exiting queueing loop!")
+				break
+			}
 			if r.Scheduler.IsDeadlocked() {
 				log.Error("deadlocked, exiting queueing loop!")
 				break
 			}
 			if r.Scheduler.AllComplete() {
-				log.Info("all tasks completed, exiting queueing loop!")
+				if r.Scheduler.AnyFailed() {
+					log.Error("all tasks not blocked by failures completed, exiting queueing loop!")
+				} else {
+					log.Info("all tasks completed, exiting queueing loop!")
+				}
 				break
 			}
 
 			// Queue anything we can
 			newScheduledTaskDefs := r.Scheduler.GetAllSchedulable()
 			for _, taskDef := range newScheduledTaskDefs {
-				newTask := tasks.NewTask(*ctx, taskDef)
+				newTask := tasks.NewTask(*ctx, taskDef, r.RunResults.RunId, r.Output)
 				log.Debug("queueing task: ", newTask.TaskDef.Id)
 				r.Scheduler.MarkScheduled(taskDef)
 				r.Queue <- &newTask
 				log.Debug("queued task: ", newTask.TaskDef.Id)
 			}
+
+			// Nothing changes until a task completes or the run is interrupted
+			select {
+			case <-r.Scheduler.Changed():
+			case <-cancelCtx.Done():
+			}
 		}
 	}()
 
 	// Block Start() on this dequeueing tasks until above goroutine signals all tasks complete via nil task
+	running := sync.WaitGroup{}
 	for {
 		task := <-r.Queue
 		if task == nil {
@@ -139,45 +240,84 @@ func (r *Runner) Start(ctx *common.Context) RunnerRunResult {
 		}
 		log.Debug("dequeued task: ", task.TaskDef.Id)
 
-		if r.Skipper.ShouldSkip(*task) {
-			log.Debug("skipping task: ", task.TaskDef.Id)
-			r.Scheduler.MarkCompleted(task.TaskDef) // worth modeling skipped / completed separately?
-			r.runResultsMutex.Lock()
-			r.RunResults.TaskRunResults = append(r.RunResults.TaskRunResults, TaskRunResult{
-				TaskId:    task.TaskDef.Id,
-				StartTime: time.Time{},
-				EndTime:   time.Time{},
-				Result:    Cached,
-			})
-			r.runResultsMutex.Unlock()
+		if cancelCtx.Err() != nil {
+			r.addResult(TaskRunResult{TaskId: task.TaskDef.Id, Result: NotRun})
 			continue
 		}
 
 		// Spawn a goroutine to run the task - we run parallel by default
 		// The scheduler takes care of dependency resolution and ordering
+		// Reserving here keeps the slots granted in dequeue order
+		slotRequest := slots.reserve(task.TaskDef, r.Scheduler.Priority(task.TaskDef.Id))
+		running.Add(1)
 		go func() {
+			defer running.Done()
+			select {
+			case <-slotRequest.granted:
+				defer slots.release(slotRequest)
+			case <-cancelCtx.Done():
+				slots.abandon(slotRequest)
+				r.addResult(TaskRunResult{TaskId: task.TaskDef.Id, Result: NotRun})
+				return
+			}
+
+			// Deciding can mean fingerprinting the whole project, so it happens here under the tasks slot
+			// rather than in the dequeueing loop, where it would hold back all other tasks
+			if r.Skipper.ShouldSkip(task, r.Scheduler.AnyDepRan(task.TaskDef)) {
+				log.Debug("skipping task: ", task.TaskDef.Id)
+				r.Scheduler.MarkCached(task.TaskDef)
+				r.addResult(TaskRunResult{
+					TaskId:    task.TaskDef.Id,
+					StartTime: time.Time{},
+					EndTime:   time.Time{},
+					Result:    Cached,
+				})
+				return
+			}
+
 			runnerResult := TaskRunResult{
 				TaskId:    task.TaskDef.Id,
 				StartTime: time.Now(),
 				EndTime:   time.Time{},
+				LogPath:   task.LogPath,
 			}
 
-			_, err := task.Run(*ctx)
-			if err != nil {
+			err := r.runAttempts(ctx, cancelCtx, task, &runnerResult)
+			if errors.Is(err, tasks.ErrInterrupted) {
+				// Nothing to record, the task didn't get to finish
+				r.Scheduler.MarkFailed(task.TaskDef)
+				runnerResult.Result = Interrupted
+			} else if err != nil {
+				r.recordRun(ctx, task, err)
 				r.Scheduler.MarkFailed(task.TaskDef)
 				runnerResult.Result = Failure
+				if errors.Is(err, tasks.ErrTimedOut) {
+					runnerResult.Result = TimedOut
+				}
+				if !r.KeepGoing {
+					cancel() // fail fast, stop the other running tasks too
+				}
 			} else {
+				r.recordRun(ctx, task, err)
 				r.Scheduler.MarkCompleted(task.TaskDef)
 				runnerResult.Result = Success
 			}
 			runnerResult.EndTime = time.Now()
-
-			r.runResultsMutex.Lock()
-			defer r.runResultsMutex.Unlock()
-			r.RunResults.TaskRunResults = append(r.RunResults.TaskRunResults, runnerResult)
+			r.addResult(runnerResult)
 		}()
 	}
 
+	// Also wait for the tasks still running when the queueing stopped, ex. on failure or interruption
+	running.Wait()
+
+	for _, task := range r.Scheduler.GetAllBlocked() {
+		r.RunResults.TaskRunResults = append(r.RunResults.TaskRunResults, TaskRunResult{
+			TaskId:    task.Id,
+			StartTime: time.Time{},
+			EndTime:   time.Time{},
+			Result:    Blocked,
+		})
+	}
 	for _, task := range r.Scheduler.GetAllUnscheduled() {
 		r.RunResults.TaskRunResults = append(r.RunResults.TaskRunResults, TaskRunResult{
 			TaskId:    task.Id,
@@ -188,5 +328,95 @@ func (r *Runner) Start(ctx *common.Context) RunnerRunResult {
 	}
 
 	r.RunResults.EndTime = time.Now()
+	r.recordHistory(ctx)
 	return *r.RunResults
 }
+
+// runAttempts runs the task, retrying it with backoff as long as it fails and has retries left
+// Each attempt is added to the result, the error of the last attempt is returned.
+func (r *Runner) runAttempts(ctx *common.Context, cancelCtx context.Context, task *tasks.Task, result *TaskRunResult) error {
+	backoff, err := task.TaskDef.GetRetryBackoff()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptStart := time.Now()
+		task.RetriesLeft = attempt <= task.TaskDef.Retries
+		_, err := task.Run(*ctx, cancelCtx)
+		result.Attempts = append(result.Attempts, TaskAttempt{
+			StartTime:  attemptStart,
+			EndTime:    time.Now(),
+			ExitStatus: tasks.ExitStatus(err),
+		})
+
+		// Interruptions are not the tasks fault, so not worth retrying
+		if err == nil || errors.Is(err, tasks.ErrInterrupted) || attempt > task.TaskDef.Retries {
+			return err
+		}
+
+		log.Warn("[task=", task.TaskDef.Id, "] attempt ", attempt, " failed, retrying in ", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-cancelCtx.Done():
+			return fmt.Errorf("%w: while waiting to retry after: %v", tasks.ErrInterrupted, err)
+		}
+		backoff *= 2
+	}
+}
+
+// lock: r/w
+func (r *Runner) addResult(result TaskRunResult) {
+	r.runResultsMutex.Lock()
+	defer r.runResultsMutex.Unlock()
+	r.RunResults.TaskRunResults = append(r.RunResults.TaskRunResults, result)
+}
+
+// recordHistory appends the finished run to the workspace run history
+func (r *Runner) recordHistory(ctx *common.Context) {
+	record := state.RunRecord{
+		RunId:     r.RunResults.RunId,
+		Args:      r.RawArgs,
+		GitHead:   lib.GitHead(lib.WsRootPath),
+		StartTime: r.RunResults.StartTime,
+		EndTime:   r.RunResults.EndTime,
+		Tasks:     []state.TaskResultRecord{},
+	}
+	for _, taskResult := range r.RunResults.TaskRunResults {
+		exitStatus, _ := taskResult.ExitStatus()
+		record.Tasks = append(record.Tasks, state.TaskResultRecord{
+			TaskId:     taskResult.TaskId,
+			Result:     string(taskResult.Result),
+			StartTime:  taskResult.StartTime,
+			EndTime:    taskResult.EndTime,
+			Attempts:   len(taskResult.Attempts),
+			ExitStatus: exitStatus,
+		})
+	}
+	err := state.AppendRunHistory(record, ctx.Workspace.Definition.Config.HistoryRetention)
+	if err != nil {
+		log.Error("failed to record run history, err: ", err)
+	}
+}
+
+// recordRun persists the outcome of a task run into the tasks persistent state
+func (r *Runner) recordRun(ctx *common.Context, task *tasks.Task, runErr error) {
+	endTime := time.Now()
+
+	// Outputs are only tracked as the last successful run left them
+	outputsHash := ""
+	if runErr == nil {
+		var err error
+		outputsHash, err = task.TaskDef.FingerprintOutputs(ctx.Logger, task.ProjectDef)
+		if err != nil {
+			log.Warn("failed to fingerprint outputs of task: ", task.TaskDef.Id, " err: ", err)
+		}
+	}
+
+	taskState := ctx.GetTaskState(task.TaskDef.Id)
+	taskState.RecordRun(endTime, tasks.ExitStatus(runErr), task.InputsHash, outputsHash)
+	err := taskState.Dump()
+	if err != nil {
+		log.Error("failed to persist state of task: ", task.TaskDef.Id, " err: ", err)
+	}
+}
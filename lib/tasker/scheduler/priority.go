@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/state"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How many of the latest runs of a task its duration is estimated from
+const estimateFromRuns = 20
+
+// How many of the latest tasker runs are searched for those
+const estimateFromHistory = 200
+
+// Estimated duration of tasks that have never run, when no task has
+// With no history at all every task weighs the same, so priorities come down to the dependency depth.
+const defaultEstimate = time.Second
+
+// estimatePriorities returns the estimated remaining critical path of every task, aka how long it takes at
+// the least from starting the task until all tasks depending on it are done.
+// Starting the tasks with the longest remaining critical path first keeps long chains from starting late.
+func estimatePriorities(tasks []defs.TaskDefinition, estimates map[defs.TaskId]time.Duration) map[defs.TaskId]time.Duration {
+	// Tasks without history are estimated at the median of the tasks with history
+	fallback := defaultEstimate
+	if len(estimates) != 0 {
+		known := []time.Duration{}
+		for _, estimate := range estimates {
+			known = append(known, estimate)
+		}
+		fallback = median(known)
+	}
+
+	dependents := map[defs.TaskId][]defs.TaskId{}
+	for _, task := range tasks {
+		for _, depId := range task.Deps {
+			dependents[depId] = append(dependents[depId], task.Id)
+		}
+	}
+
+	priorities := map[defs.TaskId]time.Duration{}
+	visiting := map[defs.TaskId]bool{}
+	var remaining func(taskId defs.TaskId) time.Duration
+	remaining = func(taskId defs.TaskId) time.Duration {
+		if priority, ok := priorities[taskId]; ok {
+			return priority
+		}
+		// A cycle never gets scheduled anyway, just don't recurse forever
+		if visiting[taskId] {
+			return 0
+		}
+		visiting[taskId] = true
+
+		longestAfter := time.Duration(0)
+		for _, dependentId := range dependents[taskId] {
+			if after := remaining(dependentId); after > longestAfter {
+				longestAfter = after
+			}
+		}
+		estimate, ok := estimates[taskId]
+		if !ok {
+			estimate = fallback
+		}
+		priorities[taskId] = estimate + longestAfter
+		return priorities[taskId]
+	}
+	for _, task := range tasks {
+		remaining(task.Id)
+	}
+	return priorities
+}
+
+// historicalEstimates returns the median duration of the latest successful runs of the tasks that have any
+func historicalEstimates(tasks []defs.TaskDefinition) map[defs.TaskId]time.Duration {
+	estimates := map[defs.TaskId]time.Duration{}
+	runs, err := state.ReadRunHistory(estimateFromHistory)
+	if err != nil {
+		log.Warn("failed to read run history, prioritizing tasks by dependency depth only, err: ", err)
+		return estimates
+	}
+
+	selected := map[defs.TaskId]bool{}
+	for _, task := range tasks {
+		selected[task.Id] = true
+	}
+	durations := map[defs.TaskId][]time.Duration{}
+	// Latest runs first, so only the latest count towards the estimate
+	for i := len(runs) - 1; i >= 0; i-- {
+		for _, task := range runs[i].Tasks {
+			// Failed runs may have stopped early, so only successful ones say how long the task takes
+			if !selected[task.TaskId] || !task.Ran() || !task.Succeeded() {
+				continue
+			}
+			if len(durations[task.TaskId]) < estimateFromRuns {
+				durations[task.TaskId] = append(durations[task.TaskId], task.Duration())
+			}
+		}
+	}
+	for taskId, taskDurations := range durations {
+		estimates[taskId] = median(taskDurations)
+	}
+	return estimates
+}
+
+func median(durations []time.Duration) time.Duration {
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"inference-tasker/lib/defs"
+	"testing"
+	"time"
+)
+
+func TestEstimatePriorities(t *testing.T) {
+	tests := []struct {
+		name      string
+		tasks     []defs.TaskDefinition
+		estimates map[defs.TaskId]time.Duration
+		want      map[defs.TaskId]time.Duration
+	}{
+		{
+			name:  "without history priorities follow the dependency depth",
+			tasks: testTasks("a:", "b: a", "c: b", "d:"),
+			want:  map[defs.TaskId]time.Duration{"a": 3 * time.Second, "b": 2 * time.Second, "c": time.Second, "d": time.Second},
+		},
+		{
+			name:      "longest chain of dependents counts",
+			tasks:     testTasks("a:", "b: a", "c: a", "d: c"),
+			estimates: map[defs.TaskId]time.Duration{"a": 1 * time.Second, "b": 10 * time.Second, "c": 2 * time.Second, "d": 3 * time.Second},
+			want:      map[defs.TaskId]time.Duration{"a": 11 * time.Second, "b": 10 * time.Second, "c": 5 * time.Second, "d": 3 * time.Second},
+		},
+		{
+			name:      "tasks without history take the median of the ones with",
+			tasks:     testTasks("a:", "b:", "c:", "new: a"),
+			estimates: map[defs.TaskId]time.Duration{"a": 1 * time.Second, "b": 4 * time.Second, "c": 9 * time.Second},
+			want:      map[defs.TaskId]time.Duration{"a": 5 * time.Second, "b": 4 * time.Second, "c": 9 * time.Second, "new": 4 * time.Second},
+		},
+		{
+			name:  "cycles don't recurse forever",
+			tasks: testTasks("a: b", "b: a"),
+			want:  map[defs.TaskId]time.Duration{"a": 2 * time.Second, "b": time.Second},
+		},
+	}
+	for _, test := range tests {
+		got := estimatePriorities(test.tasks, test.estimates)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %d priorities, want %d: %v", test.name, len(got), len(test.want), got)
+		}
+		for taskId, want := range test.want {
+			if got[taskId] != want {
+				t.Errorf("%s: priority of %s is %s, want %s", test.name, taskId, got[taskId], want)
+			}
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		durations []time.Duration
+		want      time.Duration
+	}{
+		{durations: []time.Duration{time.Second}, want: time.Second},
+		{durations: []time.Duration{3 * time.Second, time.Second, 2 * time.Second}, want: 2 * time.Second},
+		{durations: []time.Duration{4 * time.Second, time.Second, 3 * time.Second, 2 * time.Second}, want: 3 * time.Second},
+	}
+	for _, test := range tests {
+		if got := median(test.durations); got != test.want {
+			t.Errorf("median(%v) = %s, want %s", test.durations, got, test.want)
+		}
+	}
+}
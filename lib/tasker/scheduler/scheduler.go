@@ -3,8 +3,10 @@ package scheduler
 import (
 	"inference-tasker/lib/defs"
 	"inference-tasker/lib/tasker/common"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -13,28 +15,125 @@ import (
 //
 // Mainly it is "simple" because it doesn't pre-plan a full execution schedule but rather:
 // 1) Evaluates the "next runnable task" on demand.
-// 2) Requires the caller to poll for the next runnable task.
+// 2) Notifies the caller via Changed() whenever a task completes, so the caller knows when to re-evaluate.
 type Scheduler struct {
 	ctx common.Context
-	// Using arrays+mutex instead of channels because we need to contantly read to re-evaluate state on polling
+	// Using arrays+mutex instead of channels because the state is re-evaluated as a whole on every change
 	// _ prefix reminder to use mutex when accessing
 	_unscheduledTasks []defs.TaskDefinition // tasks that are not yet scheduled for execution
 	_scheduledTasks   []defs.TaskDefinition // tasks that are scheduled for execution, effectively "running"
 	_completedTasks   []defs.TaskDefinition // tasks that have completed execution whether successfully or not
 	_failedTasks      []defs.TaskDefinition // tasks that have failed execution (these tasks also in _completedTasks)
+	_cachedTasks      []defs.TaskDefinition // tasks that were skipped instead of run (these tasks also in _completedTasks)
+	_blockedTasks     []defs.TaskDefinition // tasks that can never be scheduled because a dep failed (taken out of _unscheduledTasks)
+	_pendingDeps      map[defs.TaskId]int   // how many deps of each task are not completed yet, schedulable at 0
+	_completedIds     map[defs.TaskId]bool  // ids of _completedTasks, for quick lookups
+	_cachedIds        map[defs.TaskId]bool  // ids of _cachedTasks, for quick lookups
 	// Using one mutex for all above just for simplicity sake
 	mutex sync.RWMutex
+	// Explicit tasks that were left out of this run, deps on them count as completed
+	// Never changes after creation so no need to lock
+	excludedTasks map[defs.TaskId]bool
+	// Estimated remaining critical path of each task, ready tasks with a longer one are scheduled first
+	// Never changes after creation so no need to lock
+	priorities map[defs.TaskId]time.Duration
+	// Tasks depending on each task, to update _pendingDeps when it completes
+	// Never changes after creation so no need to lock
+	dependents map[defs.TaskId][]defs.TaskId
+	// Whether the run carries on after failures, only then are the dependents of failed tasks blocked
+	// Never changes after creation so no need to lock
+	keepGoing bool
+	// Receives when a task completes, buffered so that notifying never blocks and changes coalesce
+	changed chan struct{}
 }
 
 func NewScheduler(ctx *common.Context, targs common.TaskerArgs) Scheduler {
-	// TODO: Implement filtering ws tasks based on targs
+	selectedTasks, excludedTaskIds := SelectTaskDefs(*ctx, targs)
+	return newScheduler(*ctx, selectedTasks, excludedTaskIds, historicalEstimates(selectedTasks), targs.KeepGoing)
+}
+
+// newScheduler returns a scheduler for the selected tasks, prioritized by the estimated durations of the tasks
+func newScheduler(ctx common.Context, selectedTasks []defs.TaskDefinition, excludedTaskIds []defs.TaskId, estimates map[defs.TaskId]time.Duration, keepGoing bool) Scheduler {
+	excludedTasks := map[defs.TaskId]bool{}
+	for _, taskId := range excludedTaskIds {
+		excludedTasks[taskId] = true
+	}
+
+	// Excluded explicit tasks never run, so they must not hold back their dependents
+	pendingDeps := map[defs.TaskId]int{}
+	dependents := map[defs.TaskId][]defs.TaskId{}
+	for _, task := range selectedTasks {
+		pendingDeps[task.Id] = 0
+		for _, depId := range task.Deps {
+			if excludedTasks[depId] {
+				continue
+			}
+			pendingDeps[task.Id]++
+			dependents[depId] = append(dependents[depId], task.Id)
+		}
+	}
+
 	return Scheduler{
-		ctx:               *ctx,
-		_unscheduledTasks: ctx.GetAllTaskDefs(),
+		ctx:               ctx,
+		_unscheduledTasks: selectedTasks,
 		_scheduledTasks:   []defs.TaskDefinition{},
 		_completedTasks:   []defs.TaskDefinition{},
+		_pendingDeps:      pendingDeps,
+		_completedIds:     map[defs.TaskId]bool{},
+		_cachedIds:        map[defs.TaskId]bool{},
 		mutex:             sync.RWMutex{},
+		excludedTasks:     excludedTasks,
+		priorities:        estimatePriorities(selectedTasks, estimates),
+		dependents:        dependents,
+		keepGoing:         keepGoing,
+		changed:           make(chan struct{}, 1),
+	}
+}
+
+// SelectTaskDefs returns the tasks targeted by the tasker args together with all their transitive deps.
+// A task target selects just that task, a project target selects all tasks of the project.
+// Explicit tasks are left out (and returned separately) unless they are the task target itself.
+// The result keeps the workspace order of the tasks.
+func SelectTaskDefs(ctx common.Context, targs common.TaskerArgs) ([]defs.TaskDefinition, []defs.TaskId) {
+	toVisit := []defs.TaskId{}
+	if targs.TaskId != "" {
+		toVisit = append(toVisit, targs.TaskId)
+	} else {
+		for _, task := range ctx.GetProjectDef(targs.ProjectId).TaskDefs {
+			toVisit = append(toVisit, task.Id)
+		}
+	}
+
+	// Walk the deps graph from the targets to find the closure
+	selected := map[defs.TaskId]bool{}
+	excluded := map[defs.TaskId]bool{}
+	for len(toVisit) != 0 {
+		taskId := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+		if selected[taskId] || excluded[taskId] {
+			continue
+		}
+		task := ctx.GetTaskDef(taskId)
+		if task.GetCond() == defs.ExplicitCondition && task.Id != targs.TaskId {
+			excluded[taskId] = true
+			continue
+		}
+		selected[taskId] = true
+		toVisit = append(toVisit, task.Deps...)
+	}
+
+	selectedTasks := []defs.TaskDefinition{}
+	excludedTaskIds := []defs.TaskId{}
+	for _, task := range ctx.GetAllTaskDefs() {
+		if selected[task.Id] {
+			selectedTasks = append(selectedTasks, task)
+		}
+		if excluded[task.Id] {
+			excludedTaskIds = append(excludedTaskIds, task.Id)
+		}
 	}
+	log.Debug("selected tasks for targets: ", len(selectedTasks), ", excluded explicit tasks: ", len(excludedTaskIds))
+	return selectedTasks, excludedTaskIds
 }
 
 //
@@ -62,10 +161,27 @@ func (s *Scheduler) MarkCompleted(task defs.TaskDefinition) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s._scheduledTasks = s.removeFromScheduled(task)
-	s._completedTasks = append(s._completedTasks, task)
+	s.complete(task)
+	s.notify()
+}
+
+// MarkCached marks a task as completed without having been run.
+// lock: r/w
+func (s *Scheduler) MarkCached(task defs.TaskDefinition) {
+	log.Debug("marking task cached: ", task.Id)
+
+	// Atomic: must remove from scheduled and add to completed in the same lock
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s._scheduledTasks = s.removeFromScheduled(task)
+	s.complete(task)
+	s._cachedTasks = append(s._cachedTasks, task)
+	s._cachedIds[task.Id] = true
+	s.notify()
 }
 
-// MarkFailed marks a task as failed.
+// MarkFailed marks a task as failed, when keeping going its dependents get blocked.
+// Otherwise the run stops at the first failure and the tasks left are simply not run.
 // lock: r/w
 func (s *Scheduler) MarkFailed(task defs.TaskDefinition) {
 	log.Debug("marking task failed: ", task.Id)
@@ -74,8 +190,19 @@ func (s *Scheduler) MarkFailed(task defs.TaskDefinition) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s._scheduledTasks = s.removeFromScheduled(task)
-	s._completedTasks = append(s._completedTasks, task)
+	s.complete(task)
 	s._failedTasks = append(s._failedTasks, task)
+	if s.keepGoing {
+		s.blockDependents()
+	}
+	s.notify()
+}
+
+// Changed returns a channel that receives whenever a task completed, cached or failed since the last receive.
+// The caller should re-evaluate the scheduler state after receiving instead of polling it.
+// lock: none (the channel is never replaced)
+func (s *Scheduler) Changed() <-chan struct{} {
+	return s.changed
 }
 
 // AnyFailed returns true if any tasks have failed.
@@ -103,7 +230,16 @@ func (s *Scheduler) GetAllUnscheduled() []defs.TaskDefinition {
 	return append([]defs.TaskDefinition{}, s._unscheduledTasks...)
 }
 
-// GetAllSchedulable returns all NEW tasks that are ready to be scheduled.
+// GetAllBlocked returns all tasks that can't be scheduled anymore because a dep failed.
+// lock: r
+func (s *Scheduler) GetAllBlocked() []defs.TaskDefinition {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	// Return copy to avoid caller modifying internal state
+	return append([]defs.TaskDefinition{}, s._blockedTasks...)
+}
+
+// GetAllSchedulable returns all NEW tasks that are ready to be scheduled, highest priority first.
 // lock: r
 func (s *Scheduler) GetAllSchedulable() []defs.TaskDefinition {
 	s.mutex.RLock()
@@ -119,9 +255,33 @@ func (s *Scheduler) GetAllSchedulable() []defs.TaskDefinition {
 			newSchedulableTasks = append(newSchedulableTasks, task)
 		}
 	}
+	// Stable so that tasks of the same priority keep the workspace order
+	sort.SliceStable(newSchedulableTasks, func(i, j int) bool {
+		return s.priorities[newSchedulableTasks[i].Id] > s.priorities[newSchedulableTasks[j].Id]
+	})
 	return newSchedulableTasks
 }
 
+// Priority returns the estimated remaining critical path of the task, higher should start sooner.
+// lock: none (priorities never change)
+func (s *Scheduler) Priority(taskId defs.TaskId) time.Duration {
+	return s.priorities[taskId]
+}
+
+// AnyDepRan returns true if any of the tasks deps was actually run instead of skipped.
+// lock: r
+func (s *Scheduler) AnyDepRan(task defs.TaskDefinition) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, depId := range task.Deps {
+		if s.isCompleted(depId) && !s.isCached(depId) {
+			return true
+		}
+	}
+	return false
+}
+
 // AllComplete returns true if there are no more tasks unsccheduled or scheduled (only completed).
 // lock: r
 func (s *Scheduler) AllComplete() bool {
@@ -180,30 +340,72 @@ func (s *Scheduler) anySchedulable() bool {
 
 // lock: depends on caller read lock
 func (s *Scheduler) areDepsCompleted(task defs.TaskDefinition) bool {
-	// No deps
-	if len(task.Deps) == 0 {
-		return true
+	return s._pendingDeps[task.Id] == 0
+}
+
+// complete moves a task to completed and counts it off the pending deps of its dependents
+// lock: depends on caller write lock
+func (s *Scheduler) complete(task defs.TaskDefinition) {
+	s._completedTasks = append(s._completedTasks, task)
+	s._completedIds[task.Id] = true
+	for _, dependentId := range s.dependents[task.Id] {
+		s._pendingDeps[dependentId]--
 	}
+}
 
-	// Some deps
-	for _, depId := range task.Deps {
-		currCompleted := false
+// notify wakes up whoever waits on Changed(), unless a wake up is already pending
+// lock: none
+func (s *Scheduler) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
 
-		// Find if this dep is completed
-		for _, completedTask := range s._completedTasks {
-			if depId == completedTask.Id {
-				currCompleted = true
-			}
-		}
+// blockDependents moves all unscheduled tasks that transitively depend on a failed task to blocked.
+// This lets unrelated tasks carry on and complete the run with --keep-going.
+// lock: depends on caller write lock
+func (s *Scheduler) blockDependents() {
+	unusable := map[defs.TaskId]bool{}
+	for _, task := range s._failedTasks {
+		unusable[task.Id] = true
+	}
+	for _, task := range s._blockedTasks {
+		unusable[task.Id] = true
+	}
 
-		// At least one dep isn't complete
-		if !currCompleted {
-			return false
+	// Repeat until nothing new gets blocked, as blocking a task can block its own dependents
+	for blockedAny := true; blockedAny; {
+		blockedAny = false
+		stillUnscheduled := []defs.TaskDefinition{}
+		for _, task := range s._unscheduledTasks {
+			blocked := false
+			for _, depId := range task.Deps {
+				if unusable[depId] {
+					blocked = true
+				}
+			}
+			if blocked {
+				log.Debug("blocking task on failed dep: ", task.Id)
+				unusable[task.Id] = true
+				s._blockedTasks = append(s._blockedTasks, task)
+				blockedAny = true
+			} else {
+				stillUnscheduled = append(stillUnscheduled, task)
+			}
 		}
+		s._unscheduledTasks = stillUnscheduled
 	}
+}
 
-	// All complete!
-	return true
+// lock: depends on caller read lock
+func (s *Scheduler) isCompleted(taskId defs.TaskId) bool {
+	return s._completedIds[taskId]
+}
+
+// lock: depends on caller read lock
+func (s *Scheduler) isCached(taskId defs.TaskId) bool {
+	return s._cachedIds[taskId]
 }
 
 // lock: depends on caller read lock
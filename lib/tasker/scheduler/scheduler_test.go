@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker/common"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testTasks builds tasks from "<task id>: <dep>, <dep>" entries
+func testTasks(entries ...string) []defs.TaskDefinition {
+	tasks := []defs.TaskDefinition{}
+	for _, entry := range entries {
+		id, deps, _ := strings.Cut(entry, ":")
+		task := defs.TaskDefinition{Id: defs.TaskId(strings.TrimSpace(id))}
+		for _, dep := range strings.Split(deps, ",") {
+			if dep = strings.TrimSpace(dep); dep != "" {
+				task.Deps = append(task.Deps, defs.TaskId(dep))
+			}
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+func taskIds(tasks []defs.TaskDefinition) string {
+	ids := []string{}
+	for _, task := range tasks {
+		ids = append(ids, string(task.Id))
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func TestKeepGoingBlocksDependents(t *testing.T) {
+	tasks := testTasks(
+		"a:",
+		"b: a",
+		"c: b",
+		"d:",
+		"e: c, d",
+		"f: d",
+	)
+	tests := []struct {
+		name string
+		// Run in order, the failing ones fail, all others succeed
+		failing     []defs.TaskId
+		wantBlocked string
+		wantRun     string
+	}{
+		{name: "no failures", failing: nil, wantBlocked: "", wantRun: "a,b,c,d,e,f"},
+		{name: "transitive dependents", failing: []defs.TaskId{"a"}, wantBlocked: "b,c,e", wantRun: "a,d,f"},
+		{name: "dependents only", failing: []defs.TaskId{"c"}, wantBlocked: "e", wantRun: "a,b,c,d,f"},
+		{name: "several failures", failing: []defs.TaskId{"b", "d"}, wantBlocked: "c,e,f", wantRun: "a,b,d"},
+		{name: "leaf failure", failing: []defs.TaskId{"f"}, wantBlocked: "", wantRun: "a,b,c,d,e,f"},
+	}
+	for _, test := range tests {
+		s := newScheduler(common.Context{}, tasks, nil, nil, true)
+		ran := []defs.TaskDefinition{}
+		// Keep going as the runner does, scheduling whatever is left after failures
+		for !s.AllComplete() {
+			schedulable := s.GetAllSchedulable()
+			if len(schedulable) == 0 {
+				t.Fatalf("%s: nothing schedulable but not all complete", test.name)
+			}
+			for _, task := range schedulable {
+				s.MarkScheduled(task)
+				ran = append(ran, task)
+				failed := false
+				for _, failing := range test.failing {
+					failed = failed || failing == task.Id
+				}
+				if failed {
+					s.MarkFailed(task)
+				} else {
+					s.MarkCompleted(task)
+				}
+			}
+		}
+		if got := taskIds(s.GetAllBlocked()); got != test.wantBlocked {
+			t.Errorf("%s: blocked %s, want %s", test.name, got, test.wantBlocked)
+		}
+		if got := taskIds(ran); got != test.wantRun {
+			t.Errorf("%s: ran %s, want %s", test.name, got, test.wantRun)
+		}
+		if s.IsDeadlocked() {
+			t.Errorf("%s: deadlocked", test.name)
+		}
+	}
+}
+
+func TestFailFastBlocksNothing(t *testing.T) {
+	tasks := testTasks(
+		"a:",
+		"b: a",
+		"c: b",
+		"d:",
+	)
+	s := newScheduler(common.Context{}, tasks, nil, nil, false)
+	for _, task := range s.GetAllSchedulable() {
+		s.MarkScheduled(task)
+		if task.Id == "a" {
+			s.MarkFailed(task)
+		} else {
+			s.MarkCompleted(task)
+		}
+	}
+
+	// The run stops at the failure, so the dependents are just left unscheduled
+	if got := taskIds(s.GetAllBlocked()); got != "" {
+		t.Errorf("blocked %s, want none", got)
+	}
+	if got, want := taskIds(s.GetAllUnscheduled()), "b,c"; got != want {
+		t.Errorf("unscheduled %s, want %s", got, want)
+	}
+	if !s.AnyFailed() {
+		t.Errorf("no failure recorded")
+	}
+}
+
+func TestGetAllSchedulableByPriority(t *testing.T) {
+	// "long" is on the longest chain, so it goes first even though it comes last in the workspace
+	tasks := testTasks(
+		"short:",
+		"other:",
+		"long:",
+		"after: long",
+	)
+	s := newScheduler(common.Context{}, tasks, nil, nil, false)
+	got := []string{}
+	for _, task := range s.GetAllSchedulable() {
+		got = append(got, string(task.Id))
+	}
+	if want := "long,short,other"; strings.Join(got, ",") != want {
+		t.Errorf("schedulable in order %v, want %s", got, want)
+	}
+}
@@ -7,21 +7,114 @@ import (
 )
 
 type Skipper struct {
-	ctx *common.Context
+	ctx   *common.Context
+	targs common.TaskerArgs
 }
 
 func NewSkipper(ctx *common.Context, args common.TaskerArgs) Skipper {
-	return Skipper{ctx: ctx}
+	return Skipper{ctx: ctx, targs: args}
 }
 
-func (c Skipper) ShouldSkip(task tasks.Task) bool {
-	if task.TaskDef.Cond == defs.OnceCondition {
-		return c.checkConditionOnce()
+// ShouldSkip decides if the task can be skipped based on its condition.
+// depsRan tells if any of the tasks deps actually ran (rather than being skipped) in this run.
+// For conditions that track inputs the inputs fingerprint is set on the task, for the runner to persist on success.
+func (c Skipper) ShouldSkip(task *tasks.Task, depsRan bool) bool {
+	skip, _ := c.Decide(task, depsRan)
+	return skip
+}
+
+// Decide is ShouldSkip, but also returns the reason for the decision, ex. "inputs unchanged"
+func (c Skipper) Decide(task *tasks.Task, depsRan bool) (bool, string) {
+	switch task.TaskDef.GetCond() {
+	case defs.OnceCondition:
+		return c.checkConditionOnce(*task)
+	case defs.DefaultCondition:
+		return c.checkConditionDefault(task, depsRan)
+	case defs.ExplicitCondition:
+		return c.checkConditionExplicit(*task)
+	case defs.FsChangesCondition:
+		return c.checkConditionFsChanges(task)
 	}
-	return false
+	return false, "unknown condition " + string(task.TaskDef.GetCond())
 }
 
-func (c Skipper) checkConditionOnce() bool {
+// Skip if the task has already run successfully with its current definition, unless called explicitly
+func (c Skipper) checkConditionOnce(task tasks.Task) (bool, string) {
+	if c.isExplicitlyCalled(task) {
+		return false, "called explicitly"
+	}
+	if c.ctx.GetTaskState(task.TaskDef.Id).HasSucceeded() {
+		return true, "once already satisfied"
+	}
+	return false, "never succeeded with its current definition"
+}
+
+// Skip if nothing has changed since the task last ran successfully, unless called explicitly
+// Changes are: any deps ran, the task inputs (by default the project files) changed or the task definition changed
+func (c Skipper) checkConditionDefault(task *tasks.Task, depsRan bool) (bool, string) {
+	inputsHash, err := task.TaskDef.FingerprintInputs(c.ctx.Logger, task.ProjectDef)
+	if err != nil {
+		c.ctx.Logger.Warn("failed to fingerprint inputs, not skipping task: ", task.TaskDef.Id, " err: ", err)
+		return false, "failed to fingerprint inputs"
+	}
+	task.InputsHash = inputsHash
+
+	if c.isExplicitlyCalled(*task) {
+		return false, "called explicitly"
+	}
+	if depsRan {
+		return false, "a dep ran"
+	}
+	taskState := c.ctx.GetTaskState(task.TaskDef.Id)
+	if !taskState.HasSucceeded() {
+		return false, "never succeeded with its current definition"
+	}
+	if taskState.HasInputsChanged(inputsHash) {
+		return false, "inputs changed"
+	}
+	return true, "inputs unchanged"
+}
+
+// Skip if the declared inputs and outputs are as the last successful run left them, unless called explicitly
+// Deps running doesn't matter here, what they change is expected to be covered by the declared inputs.
+func (c Skipper) checkConditionFsChanges(task *tasks.Task) (bool, string) {
+	inputsHash, err := task.TaskDef.FingerprintInputs(c.ctx.Logger, task.ProjectDef)
+	if err != nil {
+		c.ctx.Logger.Warn("failed to fingerprint inputs, not skipping task: ", task.TaskDef.Id, " err: ", err)
+		return false, "failed to fingerprint inputs"
+	}
+	task.InputsHash = inputsHash
+
+	if c.isExplicitlyCalled(*task) {
+		return false, "called explicitly"
+	}
+	outputsHash, err := task.TaskDef.FingerprintOutputs(c.ctx.Logger, task.ProjectDef)
+	if err != nil {
+		c.ctx.Logger.Warn("failed to fingerprint outputs, not skipping task: ", task.TaskDef.Id, " err: ", err)
+		return false, "failed to fingerprint outputs"
+	}
+	taskState := c.ctx.GetTaskState(task.TaskDef.Id)
+	if !taskState.HasSucceeded() {
+		return false, "never succeeded with its current definition"
+	}
+	if taskState.HasInputsChanged(inputsHash) {
+		return false, "inputs changed"
+	}
+	if taskState.HasOutputsChanged(outputsHash) {
+		return false, "outputs changed"
+	}
+	return true, "inputs and outputs unchanged"
+}
+
+// Skip unless called explicitly
+// The scheduler already leaves out explicit tasks that aren't the target, this is just a safety net
+func (c Skipper) checkConditionExplicit(task tasks.Task) (bool, string) {
+	if c.isExplicitlyCalled(task) {
+		return false, "called explicitly"
+	}
+	return true, "explicit-only"
+}
 
-	return false
+func (c Skipper) isExplicitlyCalled(task tasks.Task) bool {
+	return c.targs.TaskId == task.TaskDef.Id
 }
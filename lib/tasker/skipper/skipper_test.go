@@ -0,0 +1,127 @@
+package skipper
+
+import (
+	"inference-tasker/lib"
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker/common"
+	"inference-tasker/lib/tasker/output"
+	"inference-tasker/lib/tasker/tasks"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const testProject = `id: prj
+tasks:
+  - id: prj::once
+    cond: once
+    task: "true"
+  - id: prj::default
+    task: "true"
+  - id: prj::explicit
+    cond: explicit
+    task: "true"
+  - id: prj::fs
+    cond: unless-fs-changes
+    inputs: [src]
+    outputs: [out]
+    task: "true"
+`
+
+// loadContext loads the workspace at root as tasker does, state included
+func loadContext(t *testing.T, root string) common.Context {
+	err := lib.InitWsRoot(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.NewEntry(log.StandardLogger())
+	return common.NewContext(logger, defs.ReinitWorkspace(logger))
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecide(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root+"/tasker.yaml", "")
+	if err := os.MkdirAll(root+"/prj/src", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(root+"/prj/out", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, root+"/prj/project.yaml", testProject)
+	writeFile(t, root+"/prj/src/main.c", "int main() {}")
+	writeFile(t, root+"/prj/out/main", "binary")
+
+	// Every task has run successfully once, with the inputs and outputs as they are now
+	ctx := loadContext(t, root)
+	for _, taskDef := range ctx.GetAllTaskDefs() {
+		task := tasks.NewTask(ctx, taskDef, "", output.Interleaved)
+		inputsHash, err := taskDef.FingerprintInputs(ctx.Logger, task.ProjectDef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputsHash, err := taskDef.FingerprintOutputs(ctx.Logger, task.ProjectDef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		taskState := ctx.GetTaskState(taskDef.Id)
+		taskState.RecordRun(time.Now(), 0, inputsHash, outputsHash)
+		if err := taskState.Dump(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		// Changes to the workspace before deciding
+		change     func()
+		taskId     defs.TaskId
+		target     defs.TaskId
+		depsRan    bool
+		wantSkip   bool
+		wantReason string
+	}{
+		{name: "once succeeded", taskId: "prj::once", wantSkip: true, wantReason: "once already satisfied"},
+		{name: "once called explicitly", taskId: "prj::once", target: "prj::once", wantSkip: false, wantReason: "called explicitly"},
+		{name: "default unchanged", taskId: "prj::default", wantSkip: true, wantReason: "inputs unchanged"},
+		{name: "default after a dep ran", taskId: "prj::default", depsRan: true, wantSkip: false, wantReason: "a dep ran"},
+		{name: "explicit left out", taskId: "prj::explicit", wantSkip: true, wantReason: "explicit-only"},
+		{name: "explicit called explicitly", taskId: "prj::explicit", target: "prj::explicit", wantSkip: false, wantReason: "called explicitly"},
+		{name: "fs unchanged", taskId: "prj::fs", depsRan: true, wantSkip: true, wantReason: "inputs and outputs unchanged"},
+		{
+			name:   "fs outputs changed",
+			change: func() { writeFile(t, root+"/prj/out/main", "tampered") },
+			taskId: "prj::fs", wantSkip: false, wantReason: "outputs changed",
+		},
+		{
+			name:   "inputs changed",
+			change: func() { writeFile(t, root+"/prj/src/main.c", "int main() { return 1; }") },
+			taskId: "prj::default", wantSkip: false, wantReason: "inputs changed",
+		},
+		{name: "fs inputs changed", taskId: "prj::fs", wantSkip: false, wantReason: "inputs changed"},
+		{
+			name:   "redefined",
+			change: func() { writeFile(t, root+"/prj/project.yaml", testProject+"    timeout: 1m\n") },
+			taskId: "prj::fs", wantSkip: false, wantReason: "never succeeded with its current definition",
+		},
+	}
+	for _, test := range tests {
+		if test.change != nil {
+			test.change()
+		}
+		ctx := loadContext(t, root)
+		skipper := NewSkipper(&ctx, common.TaskerArgs{TaskId: test.target})
+		task := tasks.NewTask(ctx, ctx.GetTaskDef(test.taskId), "", output.Interleaved)
+		skip, reason := skipper.Decide(&task, test.depsRan)
+		if skip != test.wantSkip || reason != test.wantReason {
+			t.Errorf("%s: got skip %v (%s), want %v (%s)", test.name, skip, reason, test.wantSkip, test.wantReason)
+		}
+	}
+}
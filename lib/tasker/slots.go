@@ -0,0 +1,154 @@
+package tasker
+
+import (
+	"inference-tasker/lib/defs"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// slots hands out capacity from resource pools to tasks so the runner never oversubscribes the machine.
+//
+// Requests are granted highest priority first, in the order they were reserved for equal priorities.
+// A request that doesn't fit right now does not hold back later requests that do, unless they take from a pool it is
+// waiting on: that pool is held for it, so a steady stream of small requests can't keep a big one waiting forever.
+type slots struct {
+	capacity map[string]int
+	// _ prefix reminder to use mutex when accessing
+	_inUse   map[string]int
+	_waiting []*slotRequest
+	mutex    sync.Mutex
+}
+
+type slotRequest struct {
+	taskId    defs.TaskId
+	resources map[string]int
+	// ex. the tasks estimated remaining critical path, see Scheduler.Priority
+	priority time.Duration
+	// Closed once the resources are granted
+	granted chan struct{}
+}
+
+func newSlots(jobs int, pools map[string]int) *slots {
+	capacity := map[string]int{defs.JobsPool: jobs}
+	for pool, poolCapacity := range pools {
+		capacity[pool] = poolCapacity
+	}
+	return &slots{
+		capacity: capacity,
+		_inUse:   map[string]int{},
+		_waiting: []*slotRequest{},
+		mutex:    sync.Mutex{},
+	}
+}
+
+// reserve queues a request for the resources of the task, wait on the requests granted channel before running it.
+// lock: r/w
+func (s *slots) reserve(taskDef defs.TaskDefinition, priority time.Duration) *slotRequest {
+	resources := map[string]int{defs.JobsPool: 1}
+	// The pools and units are checked when loading the workspace, see defs.Validate
+	for pool, units := range taskDef.Resources {
+		resources[pool] = units
+	}
+
+	request := &slotRequest{
+		taskId:    taskDef.Id,
+		resources: resources,
+		priority:  priority,
+		granted:   make(chan struct{}),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// Behind all waiting requests of the same or higher priority
+	at := len(s._waiting)
+	for i, waitingRequest := range s._waiting {
+		if waitingRequest.priority < priority {
+			at = i
+			break
+		}
+	}
+	s._waiting = append(s._waiting[:at], append([]*slotRequest{request}, s._waiting[at:]...)...)
+	s.grantFitting()
+	return request
+}
+
+// release returns the resources of a granted request back to the pools
+// lock: r/w
+func (s *slots) release(request *slotRequest) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for pool, units := range request.resources {
+		s._inUse[pool] -= units
+	}
+	s.grantFitting()
+}
+
+// abandon withdraws a request that is no longer needed, releasing its resources if they were already granted
+// lock: r/w
+func (s *slots) abandon(request *slotRequest) {
+	s.mutex.Lock()
+	stillWaiting := []*slotRequest{}
+	for _, waitingRequest := range s._waiting {
+		if waitingRequest != request {
+			stillWaiting = append(stillWaiting, waitingRequest)
+		}
+	}
+	wasWaiting := len(stillWaiting) != len(s._waiting)
+	s._waiting = stillWaiting
+	s.mutex.Unlock()
+
+	if !wasWaiting {
+		s.release(request)
+	}
+}
+
+// lock: depends on caller write lock
+func (s *slots) grantFitting() {
+	stillWaiting := []*slotRequest{}
+	// Pools some earlier request is waiting on, aka ones the later requests must not take from
+	held := map[string]bool{}
+	for _, request := range s._waiting {
+		if !s.fits(request) || s.takesFrom(request, held) {
+			stillWaiting = append(stillWaiting, request)
+			for _, pool := range s.blockedOn(request) {
+				held[pool] = true
+			}
+			continue
+		}
+		for pool, units := range request.resources {
+			s._inUse[pool] += units
+		}
+		log.Debug("granted resources to task: ", request.taskId)
+		close(request.granted)
+	}
+	s._waiting = stillWaiting
+}
+
+// lock: depends on caller read lock
+func (s *slots) fits(request *slotRequest) bool {
+	return len(s.blockedOn(request)) == 0
+}
+
+// blockedOn returns the pools that don't have enough units left for the request
+// lock: depends on caller read lock
+func (s *slots) blockedOn(request *slotRequest) []string {
+	pools := []string{}
+	for pool, units := range request.resources {
+		if s._inUse[pool]+units > s.capacity[pool] {
+			pools = append(pools, pool)
+		}
+	}
+	return pools
+}
+
+// lock: none
+func (s *slots) takesFrom(request *slotRequest, pools map[string]bool) bool {
+	for pool := range request.resources {
+		if pools[pool] {
+			return true
+		}
+	}
+	return false
+}
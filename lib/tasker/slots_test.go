@@ -0,0 +1,180 @@
+package tasker
+
+import (
+	"inference-tasker/lib/defs"
+	"testing"
+	"time"
+)
+
+func isGranted(request *slotRequest) bool {
+	select {
+	case <-request.granted:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestSlotsReserve(t *testing.T) {
+	type reservation struct {
+		taskId    defs.TaskId
+		resources map[string]int
+		priority  time.Duration
+	}
+	tests := []struct {
+		name         string
+		jobs         int
+		pools        map[string]int
+		reservations []reservation
+		// Tasks granted right away
+		want []defs.TaskId
+		// Tasks granted, in order, as the granted ones are released one at a time
+		thenWant []defs.TaskId
+	}{
+		{
+			name:         "up to the jobs limit",
+			jobs:         2,
+			reservations: []reservation{{taskId: "a::1"}, {taskId: "a::2"}, {taskId: "a::3"}},
+			want:         []defs.TaskId{"a::1", "a::2"},
+			thenWant:     []defs.TaskId{"a::3"},
+		},
+		{
+			name:  "up to pool capacities",
+			jobs:  4,
+			pools: map[string]int{"mem": 2},
+			reservations: []reservation{
+				{taskId: "a::1", resources: map[string]int{"mem": 2}},
+				{taskId: "a::2", resources: map[string]int{"mem": 1}},
+				{taskId: "a::3"},
+			},
+			want:     []defs.TaskId{"a::1", "a::3"},
+			thenWant: []defs.TaskId{"a::2"},
+		},
+		{
+			name: "highest priority first, then in reserve order",
+			jobs: 1,
+			reservations: []reservation{
+				{taskId: "a::1", priority: time.Second},
+				{taskId: "a::2", priority: time.Second},
+				{taskId: "a::3", priority: time.Minute},
+				{taskId: "a::4", priority: time.Second},
+			},
+			want:     []defs.TaskId{"a::1"},
+			thenWant: []defs.TaskId{"a::3", "a::2", "a::4"},
+		},
+		{
+			name:  "requests that don't fit don't hold back the ones that do",
+			jobs:  2,
+			pools: map[string]int{"mem": 1},
+			reservations: []reservation{
+				{taskId: "a::1", resources: map[string]int{"mem": 1}},
+				{taskId: "a::2", resources: map[string]int{"mem": 1}, priority: time.Minute},
+				{taskId: "a::3"},
+			},
+			want:     []defs.TaskId{"a::1", "a::3"},
+			thenWant: []defs.TaskId{"a::2"},
+		},
+		{
+			name:  "a waiting request holds its pool against the ones after it",
+			jobs:  4,
+			pools: map[string]int{"mem": 2},
+			reservations: []reservation{
+				{taskId: "a::1", resources: map[string]int{"mem": 1}},
+				{taskId: "a::2", resources: map[string]int{"mem": 2}, priority: time.Minute},
+				{taskId: "a::3", resources: map[string]int{"mem": 1}},
+				{taskId: "a::4", resources: map[string]int{"mem": 1}},
+				{taskId: "a::5"},
+			},
+			want:     []defs.TaskId{"a::1", "a::5"},
+			thenWant: []defs.TaskId{"a::2", "a::3", "a::4"},
+		},
+	}
+	for _, test := range tests {
+		s := newSlots(test.jobs, test.pools)
+		requests := []*slotRequest{}
+		for _, r := range test.reservations {
+			requests = append(requests, s.reserve(defs.TaskDefinition{Id: r.taskId, Resources: r.resources}, r.priority))
+		}
+
+		granted := func() []defs.TaskId {
+			ids := []defs.TaskId{}
+			for _, request := range requests {
+				if isGranted(request) {
+					ids = append(ids, request.taskId)
+				}
+			}
+			return ids
+		}
+		if got := granted(); !equalIds(got, test.want) {
+			t.Errorf("%s: granted %v, want %v", test.name, got, test.want)
+			continue
+		}
+
+		// Release in grant order, each release should grant exactly the next one
+		order := append([]defs.TaskId{}, test.want...)
+		for i := 0; i < len(order); i++ {
+			before := granted()
+			for _, request := range requests {
+				if request.taskId == order[i] {
+					s.release(request)
+				}
+			}
+			for _, taskId := range granted() {
+				if !containsId(before, taskId) {
+					order = append(order, taskId)
+				}
+			}
+		}
+		if got := order[len(test.want):]; !equalIds(got, test.thenWant) {
+			t.Errorf("%s: then granted %v, want %v", test.name, got, test.thenWant)
+		}
+	}
+}
+
+func TestSlotsAbandon(t *testing.T) {
+	s := newSlots(1, nil)
+	running := s.reserve(defs.TaskDefinition{Id: "a::1"}, 0)
+	waiting := s.reserve(defs.TaskDefinition{Id: "a::2"}, 0)
+	next := s.reserve(defs.TaskDefinition{Id: "a::3"}, 0)
+
+	// A waiting request is just withdrawn, it never gets granted
+	s.abandon(waiting)
+	s.release(running)
+	if isGranted(waiting) || !isGranted(next) {
+		t.Fatalf("after abandoning a::2 and releasing a::1, want a::3 granted and a::2 not")
+	}
+
+	// A granted request gives its resources back
+	last := s.reserve(defs.TaskDefinition{Id: "a::4"}, 0)
+	if isGranted(last) {
+		t.Fatalf("a::4 granted while a::3 holds the only job")
+	}
+	s.abandon(next)
+	if !isGranted(last) {
+		t.Fatalf("a::4 not granted after abandoning the granted a::3")
+	}
+	if s._inUse[defs.JobsPool] != 1 {
+		t.Errorf("jobs in use: %d, want 1", s._inUse[defs.JobsPool])
+	}
+}
+
+func equalIds(a []defs.TaskId, b []defs.TaskId) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsId(ids []defs.TaskId, id defs.TaskId) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"inference-tasker/lib"
+	"inference-tasker/lib/defs"
+	"inference-tasker/lib/tasker/common"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const logsDir = "/logs"
+const logFileExt = ".log"
+const defaultLogRetention = 10
+
+// LogsDir returns the dir holding the logs of all runs of a task, aka <project>/.tasker/logs/<task>
+func LogsDir(project defs.ProjectDefinition, taskId defs.TaskId) string {
+	return project.Path + lib.TaskerDir + logsDir + "/" + strings.ReplaceAll(string(taskId), "/", "_")
+}
+
+// LogPath returns the log file of a task for one run, aka <project>/.tasker/logs/<task>/<run-id>.log
+func LogPath(project defs.ProjectDefinition, taskId defs.TaskId, runId string) string {
+	return LogsDir(project, taskId) + "/" + runId + logFileExt
+}
+
+// ListLogRunIds returns the run ids of all kept logs of a task, oldest first
+func ListLogRunIds(project defs.ProjectDefinition, taskId defs.TaskId) ([]string, error) {
+	entries, err := os.ReadDir(LogsDir(project, taskId))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	runIds := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), logFileExt) {
+			runIds = append(runIds, strings.TrimSuffix(entry.Name(), logFileExt))
+		}
+	}
+	// Run ids start with the run start time, so sorting them sorts by time
+	sort.Strings(runIds)
+	return runIds, nil
+}
+
+// openLog opens the log file of the task for appending, pruning old logs of the task first
+// Retries of a task run append to the same log file.
+func openLog(ctx common.Context, task Task) (*os.File, error) {
+	err := os.MkdirAll(filepath.Dir(task.LogPath), 0755)
+	if err != nil {
+		return nil, err
+	}
+	pruneLogs(task, ctx.Workspace.Definition.Config.LogRetention)
+
+	logFile, err := os.OpenFile(task.LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	_, err = logFile.WriteString("# " + time.Now().Format(time.RFC3339) + " running task " + string(task.TaskDef.Id) + "\n")
+	if err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	return logFile, nil
+}
+
+// pruneLogs removes the oldest logs of the task so that with the current run's log at most retention are kept
+func pruneLogs(task Task, retention int) {
+	if retention <= 0 {
+		retention = defaultLogRetention
+	}
+	runIds, err := ListLogRunIds(task.ProjectDef, task.TaskDef.Id)
+	if err != nil {
+		log.Warn("failed to list logs of task: ", task.TaskDef.Id, " err: ", err)
+		return
+	}
+
+	oldRunIds := []string{}
+	for _, runId := range runIds {
+		if LogPath(task.ProjectDef, task.TaskDef.Id, runId) != task.LogPath {
+			oldRunIds = append(oldRunIds, runId)
+		}
+	}
+	for len(oldRunIds) > retention-1 {
+		err := os.Remove(LogPath(task.ProjectDef, task.TaskDef.Id, oldRunIds[0]))
+		if err != nil {
+			log.Warn("failed to prune log of task: ", task.TaskDef.Id, " err: ", err)
+		}
+		oldRunIds = oldRunIds[1:]
+	}
+}
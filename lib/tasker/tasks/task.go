@@ -1,57 +1,92 @@
 package tasks
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"inference-tasker/lib"
 	"inference-tasker/lib/defs"
 	"inference-tasker/lib/tasker/common"
-	"io"
+	"inference-tasker/lib/tasker/output"
 	"math/rand"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// Returned (wrapped) when a task is stopped because its run was cancelled, ex. on ctrl-c
+var ErrInterrupted = errors.New("task interrupted")
+
+// Returned (wrapped) when a task is stopped because it ran past its timeout
+var ErrTimedOut = errors.New("task timed out")
+
+// How many of the last output lines RunBash returns
+const outputTailLines = 100
+
 type Task struct {
 	ProjectDef defs.ProjectDefinition
 	TaskDef    defs.TaskDefinition
+	// Fingerprint of the task inputs taken before running, set by the skipper for conditions that track inputs
+	InputsHash string
+	// Where the output of the task is written, see LogPath
+	LogPath string
+	// How the output of the task is shown on the console
+	OutputMode output.Mode
+	// Whether a failure of the current attempt gets retried, set by the runner for every attempt
+	RetriesLeft bool
 }
 
-func NewTask(ctx common.Context, taskDef defs.TaskDefinition) Task {
+func NewTask(ctx common.Context, taskDef defs.TaskDefinition, runId string, outputMode output.Mode) Task {
 	projectDef := ctx.MapTaskToProject(taskDef.Id)
 	return Task{
 		ProjectDef: projectDef,
 		TaskDef:    taskDef,
+		LogPath:    LogPath(projectDef, taskDef.Id, runId),
+		OutputMode: outputMode,
 	}
 }
 
-func (task Task) Run(ctx common.Context) (string, error) {
+// Run runs the task, cancelling cancelCtx stops it (see RunBash)
+func (task Task) Run(ctx common.Context, cancelCtx context.Context) (string, error) {
 	logPrefix := "[task=" + string(task.TaskDef.Id) + "] "
 	log.Info(logPrefix + "starting task")
-	res, err := RunBash(ctx, task)
+	res, err := RunBash(ctx, cancelCtx, task)
 	log.Info(logPrefix + "finished task")
 	return res, err
 }
 
-func RunBash(ctx common.Context, task Task) (string, error) {
+// RunBash runs the task script with bash in the project dir
+// The script runs in its own process group. When cancelCtx is cancelled the whole group gets SIGTERM,
+// then SIGKILL if it hasn't exited within the grace period, and ErrInterrupted is returned.
+// The same happens when the task runs past its timeout, but then ErrTimedOut is returned.
+func RunBash(ctx common.Context, cancelCtx context.Context, task Task) (string, error) {
 	log.Debug("running RunBashImpl for task: ", task.TaskDef.Id)
 
+	timeout, err := task.TaskDef.GetTimeout(ctx.Workspace.Definition.Config)
+	if err != nil {
+		return "", err
+	}
+	timeoutCtx := cancelCtx
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		timeoutCtx, cancelTimeout = context.WithTimeout(cancelCtx, timeout)
+		defer cancelTimeout()
+	}
+
 	// We use a tmp script file that exec.Command can execute
 	scriptId := randSeq(8)
 	tmpScriptFilePath := "/tmp/" + scriptId + ".sh"
 
-	prjEnv, err := ctx.GetProjectState(task.ProjectDef.Id).GetProjectEnv()
+	envHeader, err := EnvHeader(ctx, task.ProjectDef, task.TaskDef)
 	if err != nil {
 		return "", err
 	}
 
-	bashScript := lib.StdBashHeader() +
-		ctx.Workspace.GetEnv() +
-		prjEnv +
-		task.TaskDef.GetEnv() +
-		task.TaskDef.Task +
-		"\n"
+	bashScript := envHeader + task.TaskDef.Task + "\n"
 	err = os.WriteFile(tmpScriptFilePath, []byte(bashScript), 0777)
 	if err != nil {
 		return "", err
@@ -69,44 +104,54 @@ func RunBash(ctx common.Context, task Task) (string, error) {
 	}()
 
 	// Setup the command as a direct call to /bin/bash in the project dir
-	cmd := exec.Command("/bin/bash", tmpScriptFilePath)
+	cmd := exec.CommandContext(timeoutCtx, "/bin/bash", tmpScriptFilePath)
 	cmd.Dir = task.ProjectDef.Path
 
-	// Tail all output from the script
-	allOut := ""
-	allOutPipe, err := cmd.StdoutPipe()
-	cmd.Stderr = cmd.Stdout // pipe both stdout and stderr to the same pipe
+	// Own process group so stopping the task also stops everything the script started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		log.Warn("[task=", task.TaskDef.Id, "] interrupting task")
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = lib.StopGracePeriod // after which the script itself gets SIGKILL
+
+	logFile, err := openLog(ctx, task)
 	if err != nil {
 		return "", err
 	}
-	go func() {
-		defer allOutPipe.Close()
-		buf := make([]byte, 1024)
-		for {
-			n, err := allOutPipe.Read(buf)
-			if err != nil {
-				// Stop condition for goroutine
-				if err == io.EOF {
-					break
-				}
-			}
-			newOut := string(buf[:n])
-
-			for _, line := range strings.Split(newOut, "\n") {
-				// Sometimes seems like whitespace gets spammer?
-				// Unsure, just in case doing this and keeping an eye out
-				newOut = strings.Trim(newOut, " ")
-				if newOut == "" {
-					continue
-				}
-				log.Infof("[task=%s] %s", string(task.TaskDef.Id), line)
-			}
-			allOut += newOut
-		}
-	}()
+	defer logFile.Close()
+
+	// Stream the output line by line to the console and the log, keeping the tail to return
+	tail := output.NewTailSink(outputTailLines)
+	capture := output.NewCapture(task.TaskDef.Id, output.NewModeSink(task.OutputMode, task.LogPath, task.RetriesLeft), output.NewWriterSink(logFile), tail)
+	cmd.Stdout = capture.Stdout()
+	cmd.Stderr = capture.Stderr()
 
 	log.Debug("running script: ", tmpScriptFilePath)
-	cmdErr := cmd.Run()
+	cmdErr := cmd.Start()
+	if cmdErr == nil {
+		trackGroup(cmd.Process.Pid)
+		// Wait only returns once all output is copied to the capture, or WaitDelay gave up on it
+		cmdErr = cmd.Wait()
+		untrackGroup(cmd.Process.Pid)
+	}
+	if errors.Is(cmdErr, exec.ErrWaitDelay) && cmd.ProcessState != nil && cmd.ProcessState.Success() {
+		// The script itself succeeded, only something it left in the background still holds its output
+		log.Warn("[task=", task.TaskDef.Id, "] background processes still hold the output, no longer capturing it")
+		cmdErr = nil
+	}
+	capture.End(cmdErr)
+	if cmdErr != nil && timeoutCtx.Err() != nil {
+		// Anything in the group that outlived the script must not outlive tasker
+		if cmd.Process != nil {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		if cancelCtx.Err() != nil {
+			return "", fmt.Errorf("%w: %w", ErrInterrupted, cmdErr)
+		}
+		log.Error("[task=", task.TaskDef.Id, "] timed out after ", timeout)
+		return "", fmt.Errorf("%w after %s: %w", ErrTimedOut, timeout, cmdErr)
+	}
 	if cmdErr != nil {
 		log.Error("Failed to run script with error: ", cmdErr)
 		scriptContent, readFileErr := os.ReadFile(tmpScriptFilePath)
@@ -118,7 +163,63 @@ func RunBash(ctx common.Context, task Task) (string, error) {
 	}
 	log.Debug("finished running script: ", tmpScriptFilePath)
 
-	return string(allOut), nil
+	return tail.String(), nil
+}
+
+// Process groups of the task scripts running right now, see KillAll
+var runningGroups = map[int]bool{}
+var runningGroupsMutex sync.Mutex
+
+// KillAll kills the process groups of all running task scripts right away, without waiting for them to stop
+// lock: r/w
+func KillAll() {
+	runningGroupsMutex.Lock()
+	defer runningGroupsMutex.Unlock()
+	for pgid := range runningGroups {
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	}
+}
+
+// lock: r/w
+func trackGroup(pgid int) {
+	runningGroupsMutex.Lock()
+	defer runningGroupsMutex.Unlock()
+	runningGroups[pgid] = true
+}
+
+// lock: r/w
+func untrackGroup(pgid int) {
+	runningGroupsMutex.Lock()
+	defer runningGroupsMutex.Unlock()
+	delete(runningGroups, pgid)
+}
+
+// EnvHeader returns what RunBash prepends to the task script, the std header and the workspace, project and task env
+func EnvHeader(ctx common.Context, projectDef defs.ProjectDefinition, taskDef defs.TaskDefinition) (string, error) {
+	prjEnv, err := ctx.GetProjectState(projectDef.Id).GetProjectEnv()
+	if err != nil {
+		return "", err
+	}
+	return lib.StdBashHeader() +
+		ctx.Workspace.GetEnv() +
+		prjEnv +
+		taskDef.GetEnv(), nil
+}
+
+// ExitStatus maps the error returned from running a task to the exit status of its script
+func ExitStatus(runErr error) int {
+	if runErr == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		// Like bash, 128+n for a script killed by signal n, ex. on timeout
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	return -1 // failed before or without the script exiting
 }
 
 //
@@ -0,0 +1,31 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestExitStatus(t *testing.T) {
+	runErr := func(script string) error {
+		return exec.Command("/bin/bash", "-c", script).Run()
+	}
+	tests := []struct {
+		name   string
+		runErr error
+		want   int
+	}{
+		{name: "success", runErr: nil, want: 0},
+		{name: "failure", runErr: runErr("exit 3"), want: 3},
+		{name: "killed by a signal", runErr: runErr("kill -TERM $$"), want: 143},
+		{name: "timed out", runErr: fmt.Errorf("%w after 1s: %w", ErrTimedOut, runErr("exit 4")), want: 4},
+		{name: "interrupted", runErr: fmt.Errorf("%w: %w", ErrInterrupted, runErr("kill -INT $$")), want: 130},
+		{name: "never ran", runErr: errors.New("fork/exec: no such file"), want: -1},
+	}
+	for _, test := range tests {
+		if got := ExitStatus(test.runErr); got != test.want {
+			t.Errorf("%s: exit status %d, want %d", test.name, got, test.want)
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package lib
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
+	"math/rand"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -53,26 +58,33 @@ func (mm *masterMutex) lock() error {
 	return nil
 }
 
+// unlock unlocks and closes the file, so the masterMutex can't be locked again
 func (mm *masterMutex) unlock() error {
-	err := mm.systemWideMutex.Unlock()
+	err := mm.systemWideMutex.Close()
 	if err != nil {
-		return fmt.Errorf("outerProcessMutex.Unlock: %w", err)
+		return fmt.Errorf("outerProcessMutex.Close: %w", err)
 	}
 	mm.processWideMutex.Unlock()
 	return nil
 }
 
 // LockFile locks a file for exlusive access
+// Every lock opens the file, UnlockFile closes it again.
 // lock: r/w
 func LockFile(path string) (*masterMutex, error) {
 	mm, err := NewMasterMutex(path)
 	if err != nil {
 		return nil, fmt.Errorf("NewMasterMutex: %w", err)
 	}
-	return mm, mm.lock()
+	err = mm.lock()
+	if err != nil {
+		mm.systemWideMutex.Close()
+		return nil, err
+	}
+	return mm, nil
 }
 
-// UnlockFile unlocks a file from exlusive access
+// UnlockFile unlocks a file from exlusive access and closes it
 // lock: r/w
 func UnlockFile(mm *masterMutex) error {
 	return mm.unlock()
@@ -104,7 +116,7 @@ func InitFile(path string) error {
 
 // FindFiles returns a list of files that match the given pattern except:
 // - files that are ignored by the workspace .gitignore
-// - [optional] files that are ignored by the project .gitignore
+// - [optional] files that are ignored by the project .gitignore (the searchRoot must be the project dir)
 func FindFiles(ctxLogger *log.Entry, searchRoot string, pattern string, projectIgnoreMatcher *ignore.GitIgnore) ([]string, error) {
 	var files []string
 	err := filepath.WalkDir(searchRoot, func(path string, entry fs.DirEntry, err error) error {
@@ -112,14 +124,37 @@ func FindFiles(ctxLogger *log.Entry, searchRoot string, pattern string, projectI
 			return err
 		}
 
-		// We just care about not walking subdirs that are ignored
-		if entry.IsDir() {
-			if WorkspaceIgnoreMatcher.MatchesPath(path) {
-				return filepath.SkipDir
-			}
-			if projectIgnoreMatcher != nil && projectIgnoreMatcher.MatchesPath(path) {
-				return filepath.SkipDir
-			}
+		// Ignored subdirs are not walked at all, ignored files are just left out
+		// The matchers expect paths relative to the dir of their .gitignore file
+		ignored := matchesIgnore(WorkspaceIgnoreMatcher, WsRootPath, path, entry.IsDir()) ||
+			(projectIgnoreMatcher != nil && matchesIgnore(projectIgnoreMatcher, searchRoot, path, entry.IsDir()))
+		if ignored && entry.IsDir() {
+			return filepath.SkipDir
+		}
+		if ignored {
+			return nil
+		}
+
+		match, err := regexp.MatchString(pattern, path)
+		if err != nil {
+			log.Fatalf("regexp.MatchString: %v", err)
+		}
+		if match {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// FindAllFiles returns a list of files that match the given pattern, ignore files are not applied
+func FindAllFiles(ctxLogger *log.Entry, searchRoot string, pattern string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(searchRoot, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
 
 		match, err := regexp.MatchString(pattern, path)
@@ -136,6 +171,104 @@ func FindFiles(ctxLogger *log.Entry, searchRoot string, pattern string, projectI
 	return files, err
 }
 
+// GlobsToPattern converts globs relative to root into one pattern usable with FindFiles
+// Supported: "*" and "?" within a path segment, "**" across segments.
+// A glob matching a dir also matches everything under it, ex. "src" is the same as "src/**".
+func GlobsToPattern(root string, globs []string) string {
+	alternatives := []string{}
+	for _, glob := range globs {
+		glob = strings.TrimPrefix(glob, "./")
+		pattern := ""
+		for i := 0; i < len(glob); i++ {
+			switch {
+			case strings.HasPrefix(glob[i:], "**/"):
+				pattern += "(.*/)?"
+				i += 2
+			case strings.HasPrefix(glob[i:], "**"):
+				pattern += ".*"
+				i += 1
+			case glob[i] == '*':
+				pattern += "[^/]*"
+			case glob[i] == '?':
+				pattern += "[^/]"
+			default:
+				pattern += regexp.QuoteMeta(string(glob[i]))
+			}
+		}
+		alternatives = append(alternatives, pattern)
+	}
+	return "^" + regexp.QuoteMeta(strings.TrimSuffix(root, "/")+"/") + "(" + strings.Join(alternatives, "|") + ")(/.*)?$"
+}
+
+// matchesIgnore returns true if path is ignored by the .gitignore in ignoreRoot
+// Dirs are matched with a trailing slash so dir only patterns like "build/" apply to them.
+func matchesIgnore(ignoreMatcher *ignore.GitIgnore, ignoreRoot string, path string, isDir bool) bool {
+	relPath, err := filepath.Rel(ignoreRoot, path)
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+	if isDir {
+		relPath += "/"
+	}
+	return ignoreMatcher.MatchesPath(relPath)
+}
+
+// FingerprintFiles returns a hash over the paths and contents of the given files
+// Directories are skipped and symlinks are hashed by their target, so links into other projects are not followed.
+func FingerprintFiles(files []string) (string, error) {
+	sortedFiles := append([]string{}, files...)
+	sort.Strings(sortedFiles)
+
+	hash := sha256.New()
+	for _, path := range sortedFiles {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+
+		var content []byte
+		if info.Mode()&os.ModeSymlink == os.ModeSymlink {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", err
+			}
+			content = []byte(target)
+		} else if info.Mode().IsRegular() {
+			content, err = os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			continue
+		}
+
+		contentSum := sha256.Sum256(content)
+		hash.Write([]byte(path + "\x00" + hex.EncodeToString(contentSum[:]) + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// NewRunId returns an id for a tasker run, ex. "20230401-120000-abcd"
+// Ids start with the time so they sort by it, the random suffix keeps parallel runs apart.
+func NewRunId() string {
+	suffix := make([]byte, 4)
+	for i := range suffix {
+		suffix[i] = "abcdefghijklmnopqrstuvwxyz"[rand.Intn(26)]
+	}
+	return time.Now().Format("20060102-150405") + "-" + string(suffix)
+}
+
+// GitHead returns the commit checked out in dir, empty if dir is not in a git repo
+func GitHead(dir string) string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
 // This type represents a "header" to apply to a bash script (prepend to it)
 //
 // Example:
@@ -185,6 +318,11 @@ func WriteScriptHeader(path string, content string) error {
 	return nil
 }
 
+// ShellQuote quotes s for use as a single word in a bash script, ex. a path with spaces in an export
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 func NewScriptHeaderSection(creator string, content string) ScriptHeaderSection {
 	return ScriptHeaderSection{
 		Creator: creator,
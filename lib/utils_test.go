@@ -0,0 +1,182 @@
+package lib
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	ignore "github.com/sabhiram/go-gitignore"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestGlobsToPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		globs    []string
+		matching []string
+		other    []string
+	}{
+		{
+			name:     "star stays within a segment",
+			globs:    []string{"*.go"},
+			matching: []string{"/prj/main.go", "/prj/utils.go"},
+			other:    []string{"/prj/lib/utils.go", "/prj/main.gox", "/other/main.go"},
+		},
+		{
+			name:     "double star crosses segments",
+			globs:    []string{"src/**/*.ts"},
+			matching: []string{"/prj/src/a.ts", "/prj/src/lib/deep/b.ts"},
+			other:    []string{"/prj/a.ts", "/prj/test/a.ts"},
+		},
+		{
+			name:     "question mark is one char",
+			globs:    []string{"v?.txt"},
+			matching: []string{"/prj/v1.txt"},
+			other:    []string{"/prj/v10.txt", "/prj/v/.txt"},
+		},
+		{
+			name:     "dir matches everything under it",
+			globs:    []string{"./src"},
+			matching: []string{"/prj/src", "/prj/src/a.ts", "/prj/src/lib/b.ts"},
+			other:    []string{"/prj/srcs/a.ts", "/prj/lib/src"},
+		},
+		{
+			name:     "regexp chars are literal",
+			globs:    []string{"a+b.(c)"},
+			matching: []string{"/prj/a+b.(c)"},
+			other:    []string{"/prj/aab.(c)", "/prj/a+bx(c)"},
+		},
+		{
+			name:     "any of several globs",
+			globs:    []string{"*.go", "go.mod"},
+			matching: []string{"/prj/main.go", "/prj/go.mod"},
+			other:    []string{"/prj/go.sum"},
+		},
+	}
+	for _, test := range tests {
+		pattern := regexp.MustCompile(GlobsToPattern("/prj/", test.globs))
+		for _, path := range test.matching {
+			if !pattern.MatchString(path) {
+				t.Errorf("%s: %v should match %s", test.name, test.globs, path)
+			}
+		}
+		for _, path := range test.other {
+			if pattern.MatchString(path) {
+				t.Errorf("%s: %v should not match %s", test.name, test.globs, path)
+			}
+		}
+	}
+}
+
+func TestMatchesIgnore(t *testing.T) {
+	matcher := ignore.CompileIgnoreLines("*.log", "build/", "/out")
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: "/ws/app.log", isDir: false, want: true},
+		{path: "/ws/prj/app.log", isDir: false, want: true},
+		{path: "/ws/prj/app.txt", isDir: false, want: false},
+		{path: "/ws/prj/build", isDir: true, want: true},
+		{path: "/ws/prj/build", isDir: false, want: false}, // "build/" only ignores dirs
+		{path: "/ws/out", isDir: true, want: true},
+		{path: "/ws/prj/out", isDir: true, want: false}, // "/out" is anchored to the .gitignore dir
+		{path: "/ws", isDir: true, want: false},
+		{path: "/elsewhere/app.log", isDir: false, want: false},
+	}
+	for _, test := range tests {
+		if got := matchesIgnore(matcher, "/ws", test.path, test.isDir); got != test.want {
+			t.Errorf("matchesIgnore(%s, isDir=%v) = %v, want %v", test.path, test.isDir, got, test.want)
+		}
+	}
+}
+
+func TestFindFilesIgnores(t *testing.T) {
+	root := t.TempDir()
+	files := []string{
+		".gitignore",
+		"prj/.gitignore",
+		"prj/main.go",
+		"prj/debug.log",
+		"prj/build/out.go",
+		"prj/gen/gen.go",
+		"prj/vendor/dep.go",
+	}
+	contents := map[string]string{
+		".gitignore":     "*.log\nbuild/\n",
+		"prj/.gitignore": "gen\n",
+	}
+	for _, file := range files {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents[file]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prevRoot, prevMatcher := WsRootPath, WorkspaceIgnoreMatcher
+	defer func() { WsRootPath, WorkspaceIgnoreMatcher = prevRoot, prevMatcher }()
+	WsRootPath = root
+	WorkspaceIgnoreMatcher = ignore.CompileIgnoreLines(strings.Split(contents[".gitignore"], "\n")...)
+
+	projectMatcher := ignore.CompileIgnoreLines(strings.Split(contents["prj/.gitignore"], "\n")...)
+	found, err := FindFiles(log.NewEntry(log.StandardLogger()), root+"/prj", `\.(go|log)$`, projectMatcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, path := range found {
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, rel)
+	}
+	sort.Strings(got)
+	want := []string{"prj/main.go", "prj/vendor/dep.go"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("FindFiles found %v, want %v", got, want)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []string{"/ws", "/my ws/root", "/it's/$HOME/`x`", ""}
+	for _, s := range tests {
+		out, err := exec.Command("/bin/bash", "-c", "printf %s "+ShellQuote(s)).Output()
+		if err != nil {
+			t.Fatalf("bash with %s: %v", ShellQuote(s), err)
+		}
+		if string(out) != s {
+			t.Errorf("ShellQuote(%q) read back by bash as %q", s, out)
+		}
+	}
+}
+
+func TestLockFileClosesOnUnlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.yaml")
+	openFds := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip("no /proc to count open files in: ", err)
+		}
+		return len(entries)
+	}
+
+	before := openFds()
+	for i := 0; i < 100; i++ {
+		mm, err := LockFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := UnlockFile(mm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after := openFds(); after > before {
+		t.Errorf("%d files left open by 100 locks and unlocks", after-before)
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"fmt"
+	"inference-tasker/lib"
 	"inference-tasker/lib/defs"
 	"inference-tasker/lib/tasker"
+	"inference-tasker/lib/tasker/commands"
 	"inference-tasker/lib/tasker/common"
+	"inference-tasker/lib/tasker/report"
 	"inference-tasker/lib/tasker/scheduler"
 	"inference-tasker/lib/tasker/skipper"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/fatih/color"
 	log "github.com/sirupsen/logrus"
@@ -24,18 +28,92 @@ func main() {
 	})
 	ctxLogger := log.WithField("bin", os.Args[0])
 
-	ws := defs.InitWorkspace(ctxLogger)
-	ws.Dump() // dump it right away to be able to debug if something goes wrong
+	args := common.ParseTaskerArgs(ctxLogger, os.Args[1:])
+	if args.Command == common.InitCommand {
+		commands.Init(ctxLogger, args)
+		return
+	}
+
+	err := lib.InitWsRoot(args.Root)
+	if err != nil {
+		ctxLogger.Fatal("Error finding workspace root: ", err)
+	}
+
+	ws := defs.LoadWorkspace(ctxLogger)
 	ctx := common.NewContext(ctxLogger, ws)
-	args := common.ParseTaskerArgs(ctx, os.Args[1:])
+	switch args.Command {
+	case common.LogsCommand:
+		commands.Logs(ctx, args)
+		return
+	case common.HistoryCommand:
+		commands.History(ctx, args)
+		return
+	case common.StatsCommand:
+		commands.Stats(ctx, args)
+		return
+	case common.GraphCommand:
+		commands.Graph(ctx, args)
+		return
+	case common.ListCommand:
+		commands.List(ctx, args)
+		return
+	case common.DescribeCommand:
+		commands.Describe(ctx, args)
+		return
+	}
+	args.ResolveTarget(ctx)
+	if args.DryRun {
+		commands.DryRun(ctx, args)
+		return
+	}
 
 	// non-std tasks need scheduler/runner
 	scheduler := scheduler.NewScheduler(&ctx, args)
 	skipper := skipper.NewSkipper(&ctx, args)
-	runner := tasker.NewRunner(&scheduler, skipper)
+	runner := tasker.NewRunner(&scheduler, skipper, args)
 
 	// Will block until all tasks are done or deadlock is reached
-	fmt.Println(buildReport(runner.Start(&ctx)))
+	result := runner.Start(&ctx)
+
+	if args.Trace != "" {
+		trace, err := report.BuildTrace(ctx, result)
+		if err == nil {
+			err = os.WriteFile(args.Trace, []byte(trace), 0644)
+		}
+		if err != nil {
+			ctxLogger.Error("Error writing trace: ", err)
+		}
+	}
+
+	// With a report file the table is still printed for whoever watches the terminal
+	if args.ReportFile != "" || args.ReportFormat == common.TableReportFormat {
+		fmt.Println(buildReport(ctx, result))
+	}
+	if args.ReportFormat == common.TableReportFormat && args.ReportFile == "" {
+		return
+	}
+
+	var out string
+	switch args.ReportFormat {
+	case common.JsonReportFormat:
+		out, err = report.BuildJson(ctx, result)
+	case common.JunitReportFormat:
+		out, err = report.BuildJunit(ctx, result)
+	default:
+		color.NoColor = true // a file has no use for escape codes
+		out = buildReport(ctx, result) + "\n"
+	}
+	if err != nil {
+		ctxLogger.Fatal("Error building report: ", err)
+	}
+	if args.ReportFile == "" {
+		fmt.Print(out)
+		return
+	}
+	err = os.WriteFile(args.ReportFile, []byte(out), 0644)
+	if err != nil {
+		ctxLogger.Fatal("Error writing report: ", err)
+	}
 }
 
 func longestNonTaskCellElement(result tasker.RunnerRunResult) string {
@@ -46,16 +124,27 @@ func longestNonTaskCellElement(result tasker.RunnerRunResult) string {
 	return longestCellElement
 }
 
-func longestTaskCellElement(result tasker.RunnerRunResult) string {
+func longestTaskCellElement(result tasker.RunnerRunResult, onPath map[defs.TaskId]bool) string {
 	longestCellElement := ""
 	for _, taskResult := range result.TaskRunResults {
-		if len(taskResult.TaskId) > len(longestCellElement) {
-			longestCellElement = string(taskResult.TaskId)
+		if len(taskCell(taskResult, onPath)) > len(longestCellElement) {
+			longestCellElement = taskCell(taskResult, onPath)
 		}
 	}
 	return longestCellElement
 }
 
+// taskCell is the task id, with the attempt count if the task was retried and a mark if it is on the critical path
+func taskCell(taskResult tasker.TaskRunResult, onPath map[defs.TaskId]bool) string {
+	if onPath[taskResult.TaskId] {
+		return taskCell(taskResult, nil) + " *"
+	}
+	if len(taskResult.Attempts) > 1 {
+		return fmt.Sprintf("%s (%d attempts)", taskResult.TaskId, len(taskResult.Attempts))
+	}
+	return string(taskResult.TaskId)
+}
+
 func buildReportHeader(nonTaskCellPadding string, taskCellPadding string) string {
 	header := "| \u23F5 "
 	header += fmt.Sprintf("|%"+nonTaskCellPadding+"s", "Start")
@@ -73,12 +162,19 @@ func buildReportSeparator(header string) string {
 	return separator
 }
 
-func buildReport(result tasker.RunnerRunResult) string {
-	report := ""
+func buildReport(ctx common.Context, result tasker.RunnerRunResult) string {
+	criticalPath := report.CriticalPath(ctx, result)
+	criticalPathTaken := report.CriticalPathTaken(result, criticalPath)
+	onPath := map[defs.TaskId]bool{}
+	for _, taskId := range criticalPath {
+		onPath[taskId] = true
+	}
+
+	report := "run: " + result.RunId + "\n"
 
 	longestNonTaskCellElement := longestNonTaskCellElement(result)
 	nonTaskCellPadding := strconv.Itoa(len(longestNonTaskCellElement) + 2) // +2 for ms postfix
-	longestTaskCellElement := longestTaskCellElement(result)
+	longestTaskCellElement := longestTaskCellElement(result, onPath)
 	taskCellPadding := strconv.Itoa(len(longestTaskCellElement))
 
 	header := buildReportHeader(nonTaskCellPadding, taskCellPadding)
@@ -91,7 +187,9 @@ func buildReport(result tasker.RunnerRunResult) string {
 	for _, taskResult := range result.TaskRunResults {
 		report += "\n"
 
-		if taskResult.Result == tasker.Success {
+		if taskResult.PassedOnRetry() {
+			report += "| " + color.YellowString("%s", "\u2713") + " "
+		} else if taskResult.Result == tasker.Success {
 			report += "| " + color.GreenString("%s", "\u2713") + " "
 		} else if taskResult.Result == tasker.Failure {
 			report += "| " + color.RedString("%s", "\u2717") + " "
@@ -99,6 +197,12 @@ func buildReport(result tasker.RunnerRunResult) string {
 			report += "| " + color.YellowString("%s", "\u26A0") + " "
 		} else if taskResult.Result == tasker.Cached {
 			report += "| " + color.BlueString("%s", "\u267A") + " "
+		} else if taskResult.Result == tasker.Blocked {
+			report += "| " + color.MagentaString("%s", "\u2298") + " "
+		} else if taskResult.Result == tasker.TimedOut {
+			report += "| " + color.RedString("%s", "\u29D6") + " "
+		} else if taskResult.Result == tasker.Interrupted {
+			report += "| " + color.RedString("%s", "\u23F9") + " "
 		} else {
 			log.Fatal("Unknown task result")
 		}
@@ -112,10 +216,22 @@ func buildReport(result tasker.RunnerRunResult) string {
 		report += fmt.Sprintf("|%"+nonTaskCellPadding+"s",
 			taskResult.Taken(),
 		)
-		report += fmt.Sprintf("| %-"+taskCellPadding+"s|", string(taskResult.TaskId))
+		report += fmt.Sprintf("| %-"+taskCellPadding+"s|", taskCell(taskResult, onPath))
 	}
 
 	report += "\n" + separator
 
+	if len(criticalPath) > 0 {
+		pathIds := []string{}
+		for _, taskId := range criticalPath {
+			pathIds = append(pathIds, string(taskId))
+		}
+		report += fmt.Sprintf("\n* critical path (%dms of %dms): %s",
+			criticalPathTaken.Milliseconds(),
+			result.Taken(),
+			strings.Join(pathIds, " -> "),
+		)
+	}
+
 	return report
 }
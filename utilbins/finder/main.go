@@ -32,7 +32,12 @@ func main() {
 			"bin":               os.Args[0],
 		},
 	)
-	root, quer := parseInput()
+	wsRoot, args := lib.TakeRootFlag(os.Args[1:])
+	err := lib.InitWsRoot(wsRoot)
+	if err != nil {
+		ctxLog.Fatal("Error finding workspace root: ", err)
+	}
+	root, quer := parseInput(args)
 	ctxLog = ctxLog.WithFields(log.Fields{
 		"root": root,
 		"quer": quer,
@@ -40,7 +45,7 @@ func main() {
 	if root == "" || quer == "" {
 		ctxLog.Fatal("root or query empty!")
 	}
-	ws := defs.InitWorkspace(ctxLog)
+	ws := defs.LoadWorkspace(ctxLog)
 	result := find(ws, root, quer)
 
 	result = strings.Trim(result, " ")
@@ -50,10 +55,9 @@ func main() {
 	fmt.Println(result)
 }
 
-func parseInput() (string, string) {
+func parseInput(args []string) (string, string) {
 	root := os.Getenv(lib.FinderRootParam)
 	quer := ""
-	args := os.Args[1:]
 	if len(args) == 0 {
 		ctxLog.Fatal("no arguments passed to finder!")
 	}
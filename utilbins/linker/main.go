@@ -26,9 +26,13 @@ func main() {
 		lib.CurrTskrProject: proj,
 		"bin":               os.Args[0],
 	})
-	wsd := defs.InitWorkspace(ctxLog)
+	wsRoot, args := lib.TakeRootFlag(os.Args[1:])
+	err := lib.InitWsRoot(wsRoot)
+	if err != nil {
+		ctxLog.Fatal("Error finding workspace root: ", err)
+	}
+	wsd := defs.LoadWorkspace(ctxLog)
 	ctx := common.NewContext(ctxLog, wsd)
-	args := os.Args[1:]
 	args = cleanArgs(args)
 	validateInput(ctx, args, proj)
 
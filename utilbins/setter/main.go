@@ -25,21 +25,25 @@ func main() {
 
 	prjId := os.Getenv(lib.CurrTskrProject)
 	tskId := os.Getenv(lib.CurrTskrTask)
-	args := os.Args[1:]
+	wsRoot, args := lib.TakeRootFlag(os.Args[1:])
 	validateInput(args, prjId)
-	ws := defs.InitWorkspace(ctxLog)
 	ctxLog = log.WithFields(
 		log.Fields{
 			lib.CurrTskrProject: prjId,
 			"bin":               os.Args[0],
 		},
 	)
+	err := lib.InitWsRoot(wsRoot)
+	if err != nil {
+		ctxLog.Fatal("Error finding workspace root: ", err)
+	}
+	ws := defs.LoadWorkspace(ctxLog)
 	ctx := common.NewContext(ctxLog, ws)
 
 	// old
 	mm, err := lib.LockFile(ws.EnvFilePath)
 	if err != nil {
-		ctx.Logger.Fatal("Failed to lock env file: %v", err)
+		ctx.Logger.Fatalf("Failed to lock env file: %v", err)
 	}
 	defer lib.UnlockFile(mm)
 
@@ -64,7 +68,7 @@ func main() {
 	})
 	if err != nil {
 		ctx.Logger.
-			Fatal("Failed to set project env: %v", err)
+			Fatalf("Failed to set project env: %v", err)
 	}
 }
 